@@ -11,9 +11,63 @@
   <!-- Gemtext is plain text -->
   <xsl:output method="text" encoding="UTF-8"/>
   
+  <xsl:param name="preview"/>
+  
   <!-- Root -->
   <xsl:template match="/document">
+    <xsl:if test="$preview != ''">
+      <xsl:text>&gt; Preview: drafts and scheduled posts included, not for publishing&#10;&#10;</xsl:text>
+    </xsl:if>
+    <xsl:for-each select="meta/nav">
+      <xsl:text>=&gt; </xsl:text>
+      <xsl:value-of select="@href"/>
+      <xsl:text> </xsl:text>
+      <xsl:value-of select="@label"/>
+      <xsl:text>&#10;</xsl:text>
+    </xsl:for-each>
     <xsl:apply-templates select="body/*"/>
+    <xsl:if test="meta/previous or meta/next">
+      <xsl:text>&#10;</xsl:text> <!-- blank line before the series links -->
+      <xsl:for-each select="meta/previous">
+        <xsl:text>=&gt; </xsl:text>
+        <xsl:value-of select="@href"/>
+        <xsl:text> Previous: </xsl:text>
+        <xsl:value-of select="@title"/>
+        <xsl:text>&#10;</xsl:text>
+      </xsl:for-each>
+      <xsl:for-each select="meta/next">
+        <xsl:text>=&gt; </xsl:text>
+        <xsl:value-of select="@href"/>
+        <xsl:text> Next: </xsl:text>
+        <xsl:value-of select="@title"/>
+        <xsl:text>&#10;</xsl:text>
+      </xsl:for-each>
+    </xsl:if>
+    <xsl:if test="body/footnote[@number]">
+      <xsl:text>&#10;</xsl:text> <!-- blank line before footnotes -->
+      <xsl:for-each select="body/footnote[@number]">
+        <xsl:text>[</xsl:text>
+        <xsl:value-of select="@number"/>
+        <xsl:text>] </xsl:text>
+        <xsl:apply-templates mode="text"/>
+        <xsl:text>&#10;</xsl:text>
+      </xsl:for-each>
+    </xsl:if>
+  </xsl:template>
+  
+  <!-- SECTION -->
+  <!-- Headed only when there is more than one on the page -->
+  <xsl:template match="section">
+    <xsl:if test="count(../section) &gt; 1">
+      <xsl:text>&#10;## </xsl:text>
+      <xsl:choose>
+        <xsl:when test="@name = 'posts'">Recent Posts</xsl:when>
+        <xsl:when test="@name = 'tags'">Tags</xsl:when>
+        <xsl:otherwise><xsl:value-of select="@name"/></xsl:otherwise>
+      </xsl:choose>
+      <xsl:text>&#10;</xsl:text>
+    </xsl:if>
+    <xsl:apply-templates/>
   </xsl:template>
   
   <!-- BOLD -->
@@ -34,18 +88,30 @@
       <xsl:otherwise>
         <xsl:text>&#10;</xsl:text> <!-- ensure single line before code -->
         <xsl:text>```&#10;</xsl:text>
-        <xsl:value-of select="normalize-space(.)"/>
+        <xsl:choose>
+          <xsl:when test="*">
+            <xsl:value-of select="normalize-space(.)"/>
+          </xsl:when>
+          <xsl:otherwise>
+            <xsl:value-of select="."/> <!-- plain code, kept exactly as written -->
+          </xsl:otherwise>
+        </xsl:choose>
         <xsl:text>&#10;```&#10;</xsl:text>
       </xsl:otherwise>
     </xsl:choose>
     
   </xsl:template>
   
+  <!-- HTML has no Gemtext form -->
+  <xsl:template match="html"/>
+  
+  <!-- Tables, whether pandoc's or written as pipe tables in the post, are
+       drawn as a grid of rows and cells -->
   <xsl:template match="table">
     <xsl:variable name="tableNode" select="descendant-or-self::table"/>
     <xsl:if test="$tableNode">
       <xsl:text>```&#10;</xsl:text>
-      <xsl:variable name="colCount" select="count($tableNode//tr[1]/*[self::td or self::th])"/>
+      <xsl:variable name="colCount" select="count($tableNode//tr[1]/*[self::td or self::th] | $tableNode/row[1]/cell)"/>
       
       <xsl:call-template name="draw-border">
         <xsl:with-param name="table" select="$tableNode"/>
@@ -53,7 +119,7 @@
         <xsl:with-param name="totalCols" select="$colCount"/>
       </xsl:call-template>
       
-      <xsl:for-each select="$tableNode//tr">
+      <xsl:for-each select="$tableNode//tr | $tableNode/row">
         <xsl:call-template name="render-row">
           <xsl:with-param name="table" select="$tableNode"/>
           <xsl:with-param name="totalCols" select="$colCount"/>
@@ -67,11 +133,11 @@
     <xsl:param name="table"/>
     <xsl:param name="totalCols"/>
     <xsl:text>|</xsl:text>
-    <xsl:for-each select="*[self::td or self::th]">
+    <xsl:for-each select="*[self::td or self::th or self::cell]">
       <xsl:variable name="pos" select="position()"/>
       <xsl:variable name="width">
         <xsl:call-template name="get-max-width">
-          <xsl:with-param name="nodes" select="$table//tr/*[position() = $pos]"/>
+          <xsl:with-param name="nodes" select="($table//tr | $table/row)/*[position() = $pos]"/>
         </xsl:call-template>
       </xsl:variable>
       
@@ -100,7 +166,7 @@
     
     <xsl:variable name="width">
       <xsl:call-template name="get-max-width">
-        <xsl:with-param name="nodes" select="$table//tr/*[position() = $colIndex]"/>
+        <xsl:with-param name="nodes" select="($table//tr | $table/row)/*[position() = $colIndex]"/>
       </xsl:call-template>
     </xsl:variable>
     
@@ -170,7 +236,7 @@
   
   <xsl:template match="item" mode="item-group">
     <xsl:text>* </xsl:text>
-    <xsl:value-of select="."/>
+    <xsl:apply-templates mode="text"/>
     <xsl:text>&#10;</xsl:text>
   </xsl:template>
   
@@ -198,13 +264,48 @@
   </xsl:template>
   
   <!-- TEXT -->
+  <!-- Links within a paragraph follow it, Gemtext having no inline links -->
   <xsl:template match="text">
     <xsl:variable name="t" select="normalize-space(.)"/>
     <xsl:if test="$t != ''">
       <xsl:text>&#10;</xsl:text>  <!-- single blank line before paragraph -->
-      <xsl:value-of select="$t"/>
+      <xsl:apply-templates mode="text"/>
       <xsl:text>&#10;</xsl:text>
+      <xsl:for-each select=".//link">
+        <xsl:text>=&gt; </xsl:text>
+        <xsl:value-of select="@href"/>
+        <xsl:text> </xsl:text>
+        <xsl:value-of select="."/>
+        <xsl:text>&#10;</xsl:text>
+      </xsl:for-each>
+    </xsl:if>
+  </xsl:template>
+  
+  <!-- keep a single space where text meets an inline element -->
+  <xsl:template match="text()" mode="text">
+    <xsl:variable name="text" select="normalize-space(.)"/>
+    <xsl:if test="preceding-sibling::node()[1][not(self::break)] and normalize-space(substring(., 1, 1)) = ''">
+      <xsl:text> </xsl:text>
+    </xsl:if>
+    <xsl:value-of select="$text"/>
+    <xsl:if test="$text != '' and following-sibling::node()[1][not(self::break)] and normalize-space(substring(., string-length(.))) = ''">
+      <xsl:text> </xsl:text>
     </xsl:if>
   </xsl:template>
   
+  <xsl:template match="footnote-ref[@number]" mode="text">
+    <xsl:text>[</xsl:text>
+    <xsl:value-of select="@number"/>
+    <xsl:text>]</xsl:text>
+  </xsl:template>
+  
+  <!-- FOOTNOTE -->
+  <!-- Collected at the end of the page -->
+  <xsl:template match="footnote"/>
+  
+  <!-- A hard line break is a new Gemtext line -->
+  <xsl:template match="break" mode="text">
+    <xsl:text>&#10;</xsl:text>
+  </xsl:template>
+  
 </xsl:stylesheet>
\ No newline at end of file
@@ -5,6 +5,12 @@
     
     <xsl:output method="xml" encoding="UTF-8" indent="yes" omit-xml-declaration="yes"/>
     <xsl:strip-space elements="*"/>
+    <!-- Pandoc separates the lines of a highlighted block with bare newlines -->
+    <xsl:preserve-space elements="code span"/>
+    
+    <xsl:param name="baseURL"/>
+    <xsl:param name="highlightTheme"/>
+    <xsl:param name="preview"/>
 
     <!-- Root -->
     <xsl:template match="/document">
@@ -14,34 +20,148 @@
                 <meta name="viewport" content="width=device-width" />
                 <link rel="icon" type="image/x-icon" href="/favicon.ico" />
                 <title><xsl:value-of select="meta/title/@value"/></title>
+                <xsl:if test="meta/unlisted">
+                    <meta name="robots" content="noindex" />
+                </xsl:if>
+                <xsl:if test="$highlightTheme != ''">
+                    <link rel="stylesheet" href="/highlight.css" />
+                </xsl:if>
+                <xsl:if test="meta/canonical">
+                    <link rel="canonical" href="{meta/canonical/@value}" />
+                </xsl:if>
+                <xsl:if test="$baseURL != ''">
+                    <link rel="alternate" type="application/atom+xml" href="/atom.xml" />
+                    <link rel="alternate" type="application/rss+xml" href="/rss.xml" />
+                </xsl:if>
+                <xsl:for-each select="meta/og">
+                    <meta property="{@name}" content="{@value}" />
+                </xsl:for-each>
+                <xsl:for-each select="meta/twitter">
+                    <meta name="{@name}" content="{@value}" />
+                </xsl:for-each>
+                <xsl:for-each select="meta/jsonld">
+                    <script type="application/ld+json"><xsl:value-of select="."/></script>
+                </xsl:for-each>
             </head>
             <body>
+                <xsl:if test="$preview != ''">
+                    <p class="preview"><strong>Preview: drafts and scheduled posts included, not for publishing</strong></p>
+                </xsl:if>
+                <xsl:if test="meta/nav">
+                    <nav>
+                        <xsl:for-each select="meta/nav">
+                            <a href="{@href}"><xsl:value-of select="@label"/></a>
+                        </xsl:for-each>
+                    </nav>
+                </xsl:if>
                 <xsl:apply-templates select="body/*"/>
+                <xsl:if test="meta/previous or meta/next">
+                    <nav class="series">
+                        <xsl:for-each select="meta/previous">
+                            <a rel="prev" href="{@href}">← <xsl:value-of select="@title"/></a>
+                        </xsl:for-each>
+                        <xsl:for-each select="meta/next">
+                            <a rel="next" href="{@href}"><xsl:value-of select="@title"/> →</a>
+                        </xsl:for-each>
+                    </nav>
+                </xsl:if>
+                <xsl:if test="body/footnote[@number]">
+                    <section class="footnotes">
+                        <hr/>
+                        <ol>
+                            <xsl:for-each select="body/footnote[@number]">
+                                <li id="fn-{@id}">
+                                    <xsl:apply-templates mode="text"/>
+                                    <xsl:text> </xsl:text>
+                                    <a href="#fnref-{@id}">↩</a>
+                                </li>
+                            </xsl:for-each>
+                        </ol>
+                    </section>
+                </xsl:if>
             </body>
         </html>
     </xsl:template>
     
     <!-- TEXT -->
-    <!-- Trim leading/trailing whitespace, keep internal formatting -->
+    <!-- Reflow each line, keep the hard line breaks -->
     <xsl:template match="text">
         <p>
-            <xsl:value-of select="normalize-space(
-                    concat(
-                        substring(., 1, 1),
-                        substring(., 2)
-                    )
-                )"/>
+            <xsl:apply-templates mode="text"/>
         </p>
     </xsl:template>
     
+    <!-- keep a single space where text meets an inline element -->
+    <xsl:template match="text()" mode="text">
+        <xsl:variable name="text" select="normalize-space(.)"/>
+        <xsl:if test="preceding-sibling::node()[1][not(self::break)] and normalize-space(substring(., 1, 1)) = ''">
+            <xsl:text> </xsl:text>
+        </xsl:if>
+        <xsl:value-of select="$text"/>
+        <xsl:if test="$text != '' and following-sibling::node()[1][not(self::break)] and normalize-space(substring(., string-length(.))) = ''">
+            <xsl:text> </xsl:text>
+        </xsl:if>
+    </xsl:template>
+    
+    <xsl:template match="break" mode="text">
+        <br/>
+    </xsl:template>
+    
+    <!-- inline Markdown, with paragraphs set to markdown -->
+    <xsl:template match="emphasis" mode="text">
+        <em><xsl:apply-templates mode="text"/></em>
+    </xsl:template>
+    
+    <xsl:template match="strong" mode="text">
+        <strong><xsl:apply-templates mode="text"/></strong>
+    </xsl:template>
+    
+    <xsl:template match="code" mode="text">
+        <code><xsl:value-of select="."/></code>
+    </xsl:template>
+    
+    <xsl:template match="link" mode="text">
+        <a href="{@href}"><xsl:value-of select="."/></a>
+    </xsl:template>
+    
+    <xsl:template match="footnote-ref[@number]" mode="text">
+        <sup><a id="fnref-{@id}" href="#fn-{@id}"><xsl:value-of select="@number"/></a></sup>
+    </xsl:template>
+    
+    <!-- FOOTNOTE -->
+    <!-- Collected at the bottom of the page -->
+    <xsl:template match="footnote"/>
+    
     <!-- LINK -->
     <xsl:template match="link">
         <a href="{@href}"><xsl:value-of select="."/></a><br/>
     </xsl:template>
     
+    <!-- SECTION -->
+    <!-- Headed only when there is more than one on the page -->
+    <xsl:template match="section">
+        <section class="{@name}">
+            <xsl:if test="count(../section) &gt; 1">
+                <h2>
+                    <xsl:choose>
+                        <xsl:when test="@name = 'posts'">Recent Posts</xsl:when>
+                        <xsl:when test="@name = 'tags'">Tags</xsl:when>
+                        <xsl:otherwise><xsl:value-of select="@name"/></xsl:otherwise>
+                    </xsl:choose>
+                </h2>
+            </xsl:if>
+            <xsl:apply-templates/>
+        </section>
+    </xsl:template>
+    
     <!-- BOLD -->
     <xsl:template match="bold">
-        <strong><p><xsl:value-of select="."/></p></strong>
+        <strong><p>
+            <xsl:if test="@id">
+                <xsl:attribute name="id"><xsl:value-of select="@id"/></xsl:attribute>
+            </xsl:if>
+            <xsl:value-of select="."/>
+        </p></strong>
     </xsl:template>
     
     <!-- CODE -->
@@ -53,16 +173,47 @@
                 <xsl:apply-templates select="table"/>
             </xsl:when>
             
-            <!-- Plain code -->
-            <xsl:otherwise>
+            <!-- Code highlighted by pandoc, token spans kept for highlight.css -->
+            <xsl:when test="div[@class='sourceCode']">
+                <pre class="sourceCode"><code><xsl:apply-templates select="div/pre/code/node()" mode="highlight"/></code></pre>
+            </xsl:when>
+            
+            <!-- Code converted by pandoc -->
+            <xsl:when test="*">
                 <pre><code>
                         <xsl:value-of select="normalize-space(.)"/>
                     </code></pre>
+            </xsl:when>
+            
+            <!-- Plain code, kept exactly as written -->
+            <xsl:otherwise>
+                <pre><code><xsl:value-of select="."/></code></pre>
             </xsl:otherwise>
             
         </xsl:choose>
     </xsl:template>
     
+    <xsl:template match="span[@class]" mode="highlight">
+        <span class="{@class}"><xsl:apply-templates mode="highlight"/></span>
+    </xsl:template>
+    
+    <!-- Line spans and their anchors are dropped, their text kept -->
+    <xsl:template match="span" mode="highlight">
+        <xsl:apply-templates mode="highlight"/>
+    </xsl:template>
+    
+    <xsl:template match="a" mode="highlight"/>
+    
+    <xsl:template match="text()" mode="highlight">
+        <xsl:value-of select="."/>
+    </xsl:template>
+    
+    <!-- HTML -->
+    <!-- Passed through as written in the post -->
+    <xsl:template match="html">
+        <xsl:value-of select="." disable-output-escaping="yes"/>
+    </xsl:template>
+    
     <xsl:template match="table">
         <table>
             <xsl:apply-templates/>
@@ -84,6 +235,34 @@
         </td>
     </xsl:template>
     
+    <!-- TABLE -->
+    <!-- Pipe tables written in the post, header row first -->
+    <xsl:template match="body/table">
+        <table>
+            <xsl:for-each select="row">
+                <tr>
+                    <xsl:for-each select="cell">
+                        <xsl:choose>
+                            <xsl:when test="../@header = 'true'">
+                                <th><xsl:call-template name="table-cell"/></th>
+                            </xsl:when>
+                            <xsl:otherwise>
+                                <td><xsl:call-template name="table-cell"/></td>
+                            </xsl:otherwise>
+                        </xsl:choose>
+                    </xsl:for-each>
+                </tr>
+            </xsl:for-each>
+        </table>
+    </xsl:template>
+    
+    <xsl:template name="table-cell">
+        <xsl:if test="@align">
+            <xsl:attribute name="style">text-align: <xsl:value-of select="@align"/></xsl:attribute>
+        </xsl:if>
+        <xsl:apply-templates mode="text"/>
+    </xsl:template>
+    
     <!-- FIRST ITEM IN A SEQUENCE -->
     <xsl:template match="item[not(preceding-sibling::*[1][self::item])]">
         <ul>
@@ -102,7 +281,7 @@
     
     <xsl:template match="item" mode="item-group">
         <li>
-            <xsl:value-of select="."/>
+            <xsl:apply-templates mode="text"/>
         </li>
     </xsl:template>
     
@@ -1,27 +1,140 @@
 package main
 
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"phetour/source/phetour"
+)
+
 func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "phetour: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	command := "build"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
 
-	keylock, err := LoadKeylock()
+	config, err := phetour.LoadConfig()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	taxonomy := NewTaxonomy(keylock)
+	switch command {
+	case "build":
+		flags := flag.NewFlagSet("build", flag.ContinueOnError)
+		flags.BoolVar(&config.DryRun, "dry-run", false, "print what a build would remove and generate, without writing anything")
+		flags.BoolVar(&config.Strict, "strict", config.Strict, "treat warnings as errors")
+		flags.BoolVar(&config.Quiet, "quiet", config.Quiet, "print no report at the end of the build")
+		flags.BoolVar(&config.Future, "future", config.Future, "include posts dated after the build")
+		flags.BoolVar(&config.Force, "force", false, "transform every page, even if its output is up to date")
+		flags.BoolVar(&config.StylesOnly, "styles", false, "only apply the stylesheets again when nothing else changed since the last build")
+		flags.BoolVar(&config.Bundle, "bundle", config.Bundle, "also write every post into one page for offline reading")
+		flags.BoolVar(&config.CheckExternalLinks, "check-external", config.CheckExternalLinks, "also check links to other sites")
+		flags.StringVar(&config.XSLTCommand, "xslt-command", config.XSLTCommand, "command template for the external XSLT processor")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
 
-	source, err := LoadSource(keylock, taxonomy)
-	if err != nil {
-		panic(err)
+		return phetour.Generate(config)
+
+	case "serve":
+		flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+		port := flags.Int("port", 8080, "port to listen on")
+		style := flags.String("style", "html", "output directory to serve")
+		flags.BoolVar(&config.Future, "future", config.Future, "include posts dated after the build")
+		drafts := flags.Bool("drafts", false, "preview drafts and posts dated after the build, built into previewPath")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		// A preview is built apart, so that the next build of the site
+		// does not take its pages, banner and drafts, as up to date.
+		if *drafts {
+			config.Drafts, config.Future, config.Preview = true, true, true
+			config.OutputPath = config.PreviewPath
+		}
+
+		if err := phetour.Generate(config); err != nil {
+			return err
+		}
+		return phetour.Serve(config, *style, *port)
+
+	case "tags":
+		return reportTags(config)
+
+	case "clean":
+		flags := flag.NewFlagSet("clean", flag.ContinueOnError)
+		flags.BoolVar(&config.DryRun, "dry-run", false, "list what would be removed, without removing anything")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		return phetour.Clean(config)
+
+	case "new":
+		var draft phetour.Draft
+		flags := flag.NewFlagSet("new", flag.ContinueOnError)
+		flags.BoolVar(&draft.Draft, "draft", false, "mark the post as a draft")
+		flags.StringVar(&draft.Date, "date", "", "publication date of the post")
+		flags.Func("tag", "tag the post; may repeat", func(tag string) error {
+			draft.Tags = append(draft.Tags, tag)
+			return nil
+		})
+
+		// Flags may come before or after the title.
+		var words []string
+		for {
+			if err := flags.Parse(args); err != nil {
+				return err
+			}
+			if flags.NArg() == 0 {
+				break
+			}
+			words = append(words, flags.Arg(0))
+			args = flags.Args()[1:]
+		}
+		draft.Title = strings.Join(words, " ")
+
+		path, err := phetour.NewPost(draft, config)
+		if err != nil {
+			return err
+		}
+		fmt.Println(path)
+		return nil
 	}
 
-	err = Build(source, taxonomy)
+	return fmt.Errorf("unknown command '%s'", command)
+}
+
+// reportTags lists every tag with the number of posts using it, followed by
+// the tags lock.xml still holds an ID for that no post uses anymore.
+func reportTags(config *phetour.Config) error {
+	keylock, err := phetour.LoadKeylock(config)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	taxonomy := phetour.NewTaxonomy(keylock)
+	if _, err := phetour.LoadSource(keylock, taxonomy, config); err != nil {
+		return err
 	}
 
-	err = keylock.Save()
-	if err != nil {
-		panic(err)
+	tags := slices.Clone(taxonomy.Tags)
+	slices.SortFunc(tags, func(a, b phetour.Tag) int { return cmp.Compare(a.Key, b.Key) })
+	for _, tag := range tags {
+		fmt.Printf("%s\t%d\t%s\n", phetour.FormatKey(tag.Key, config), len(tag.Mentions), tag.Label)
+	}
+	for _, tag := range phetour.UnusedTags(taxonomy) {
+		fmt.Printf("%s\tunused\t%s\n", phetour.FormatKey(tag.Key, config), tag.Label)
 	}
 
+	return nil
 }
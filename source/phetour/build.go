@@ -0,0 +1,285 @@
+package phetour
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	staticsInputPath = "./input/statics"
+	stylesInputPath  = "./input/styles"
+)
+
+// checkKeyWidth warns once keys outgrow keyWidth, since from then on
+// directory names no longer share one length.
+func checkKeyWidth(keylock *Keylock, config *Config) []string {
+	var widest Key
+	for _, key := range keylock.Keys {
+		if key.ID > widest.ID {
+			widest = key
+		}
+	}
+	if config.KeyFormat != "hex" || len(strconv.FormatInt(int64(widest.ID), 16)) <= config.KeyWidth {
+		return nil
+	}
+	return []string{fmt.Sprintf("key %s of %s is wider than keyWidth %d", FormatKey(widest.ID, config), widest.Value, config.KeyWidth)}
+}
+
+// checkStyles warns about posts asking for a style that has no directory
+// of stylesheets, since those posts fall back to the site's stylesheets.
+func checkStyles(source *Source) []string {
+	var warnings []string
+	for _, post := range source.Posts {
+		if post.Style == "" {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(stylesInputPath, post.Style)); err != nil || !info.IsDir() {
+			warnings = append(warnings, fmt.Sprintf("post %s asks for style '%s', which has no directory in %s", post.Name, post.Style, stylesInputPath))
+		}
+	}
+	return warnings
+}
+
+// styleOutputDirectories returns the directory every stylesheet writes to,
+// except the primary one, whose pages go straight into the output root,
+// and whether the primary one was among them.
+func styleOutputDirectories(xslFiles []string, config *Config) ([]string, bool) {
+	var styleDirectories []string
+	primaryFound := false
+	for _, xslFile := range xslFiles {
+		styleName := styleNameOf(xslFile)
+		if styleName == config.PrimaryStyle {
+			primaryFound = true
+			continue
+		}
+		styleDirectories = append(styleDirectories, styleName)
+	}
+	return styleDirectories, primaryFound
+}
+
+func Build(source *Source, taxonomy *Taxonomy, config *Config) (report *Report, err error) {
+	xmlOutputPath := filepath.Join(config.OutputPath, "xml")
+
+	// Taken before any XML is written, so that an input changed during the
+	// build is not taken as built by the next build -styles.
+	sources, err := sourcesFingerprint(taxonomy.Keylock, config)
+	if err != nil {
+		return nil, err
+	}
+
+	xslFiles, err := findStylesheets(stylesInputPath)
+	if err != nil {
+		return nil, err
+	}
+	styleDirectories, primaryFound := styleOutputDirectories(xslFiles, config)
+	ownedDirectories := append([]string{"xml"}, styleDirectories...)
+
+	if config.PrimaryStyle != "" {
+		if !primaryFound {
+			return nil, fmt.Errorf("primary style %s has no stylesheet in %s", config.PrimaryStyle, stylesInputPath)
+		}
+		for _, post := range source.Posts {
+			if slices.Contains(ownedDirectories, post.Slug) {
+				return nil, fmt.Errorf("slug '%s' of post %s collides with an output directory", post.Slug, post.Name)
+			}
+		}
+		ownedDirectories = append(ownedDirectories, ".")
+	}
+
+	if err := warn(config, checkKeyWidth(taxonomy.Keylock, config)); err != nil {
+		return nil, err
+	}
+
+	if err := warn(config, checkStyles(source)); err != nil {
+		return nil, err
+	}
+
+	manifest, err := LoadManifest(config.OutputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest != nil && manifest.Keys != "" && manifest.Keys != keyScheme(config) {
+		warning := fmt.Sprintf("keys were rendered as %s and are now rendered as %s, which changes the URL of every post, tag and author", manifest.Keys, keyScheme(config))
+		if err := warn(config, []string{warning}); err != nil {
+			return nil, err
+		}
+	}
+
+	if manifest == nil {
+		manifest, err = adoptedManifest(config.OutputPath, styleDirectories)
+		if err != nil {
+			return nil, err
+		}
+	}
+	previous := manifest.Hashes()
+
+	kept := keptStatics(config.OutputPath, manifest)
+	stale := stalePaths(config.OutputPath, manifest, kept)
+
+	// A dry run lists the intermediate XML that would be removed and prints
+	// the XML replacing it, but changes nothing on disk.
+	var foreign, statics map[string]bool
+	if config.DryRun {
+		for _, path := range stale {
+			fmt.Printf("would remove %s\n", path)
+		}
+	} else {
+		if err := removeStale(config.OutputPath, stale); err != nil {
+			return nil, err
+		}
+
+		foreign, err = foreignFiles(config.OutputPath, ownedDirectories, previous)
+		if err != nil {
+			return nil, err
+		}
+
+		// From here on files are written, and a build failing halfway
+		// still records them.
+		defer func() {
+			if err != nil {
+				err = errors.Join(err, savePartialManifest(ownedDirectories, foreign, statics, config))
+			}
+		}()
+
+		if err := makeOutputDir(xmlOutputPath, config); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+
+	report = &Report{
+		Posts:       len(source.Posts),
+		Drafts:      source.Drafts,
+		Scheduled:   source.Scheduled,
+		Tags:        len(taxonomy.Tags),
+		Authors:     len(taxonomy.Authors),
+		Sections:    len(taxonomy.Sections),
+		Stylesheets: len(xslFiles),
+	}
+
+	start := time.Now()
+	for _, post := range source.Posts {
+		if err := buildPost(post, xmlOutputPath, source, taxonomy, config); err != nil {
+			return nil, fmt.Errorf("failed to build post %s: %w", post.Name, err)
+		}
+	}
+
+	for _, tag := range taxonomy.Tags {
+		if err := buildTag(tag, config.TagDescriptions[tag.Label], xmlOutputPath, source, config); err != nil {
+			return nil, fmt.Errorf("failed to build tag %s: %w", tag.Label, err)
+		}
+	}
+
+	for _, author := range taxonomy.Authors {
+		if err := buildTag(author, "", xmlOutputPath, source, config); err != nil {
+			return nil, fmt.Errorf("failed to build author %s: %w", author.Label, err)
+		}
+	}
+
+	for _, section := range taxonomy.Sections {
+		if err := buildSection(section, xmlOutputPath, source, config); err != nil {
+			return nil, fmt.Errorf("failed to build section %s: %w", section.Label, err)
+		}
+	}
+
+	for _, series := range taxonomy.Series {
+		if err := buildSeries(series, xmlOutputPath, source, config); err != nil {
+			return nil, fmt.Errorf("failed to build series %s: %w", series.Label, err)
+		}
+	}
+
+	if err := buildHomeCatalog(source, taxonomy, xmlOutputPath, config); err != nil {
+		return nil, fmt.Errorf("failed to build home catalog: %w", err)
+	}
+
+	if err := buildTagsIndex(taxonomy, xmlOutputPath, config); err != nil {
+		return nil, err
+	}
+
+	if err := buildSitemap(source, taxonomy, config, xmlOutputPath); err != nil {
+		return nil, err
+	}
+
+	if err := buildFeeds(source, taxonomy, xmlOutputPath, config); err != nil {
+		return nil, err
+	}
+
+	if err := buildRobots(config, xmlOutputPath); err != nil {
+		return nil, err
+	}
+
+	if err := buildSearchIndex(source, taxonomy, xmlOutputPath, config); err != nil {
+		return nil, err
+	}
+
+	if err := buildHighlightCSS(config, xmlOutputPath); err != nil {
+		return nil, err
+	}
+
+	if err := buildBundle(source, xmlOutputPath, config); err != nil {
+		return nil, err
+	}
+
+	report.timeStage("pages", start)
+
+	if config.DryRun {
+		return report, nil
+	}
+
+	start = time.Now()
+
+	statics, err = copyStatics(staticsInputPath, xmlOutputPath, kept, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy static files: %w", err)
+	}
+	// Copies left in kept belong to statics removed or ignored since.
+	if err := removeStale(config.OutputPath, slices.Collect(maps.Keys(kept))); err != nil {
+		return nil, err
+	}
+	report.Statics = len(statics)
+	report.timeStage("statics", start)
+
+	start = time.Now()
+
+	if err := warn(config, checkLinks(source, xmlOutputPath, config)); err != nil {
+		return nil, err
+	}
+	report.timeStage("links", start)
+
+	// Pages of posts with a style field are transformed with that style's
+	// stylesheets where it has one for the output style.
+	styles := map[string]string{}
+	for _, post := range source.Posts {
+		if post.Style != "" {
+			styles[post.Dir(config)+"/index.xml"] = post.Style
+		}
+	}
+
+	start = time.Now()
+	produced, applied, err := applyStylesheets(xmlOutputPath, xslFiles, styles, config, previous, manifest.StyleParams())
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply stylesheets: %w", err)
+	}
+	report.Outputs = len(produced)
+	report.timeStage("stylesheets", start)
+
+	if err := removeStale(config.OutputPath, leftoverPaths(config.OutputPath, manifest, produced)); err != nil {
+		return nil, err
+	}
+
+	manifest, err = NewManifest(config.OutputPath, ownedDirectories, foreign, statics)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Keys = keyScheme(config)
+	manifest.Sources = sources
+	manifest.Scheduled = source.NextScheduled
+	manifest.Params = applied
+	return report, manifest.Save(config)
+}
@@ -0,0 +1,138 @@
+package phetour
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+const bundleDir = "bundle"
+
+// buildBundle writes every listed post, newest first, into the single page
+// bundle/index.xml, for a copy of the site that reads offline. It is made
+// from the posts' own pages, so buildPost must have run. Links between the
+// posts become links within the page, links to statics carry the file
+// itself as a data URL, and other links to the site are made absolute when
+// there is a baseURL. Nothing is written unless bundle is on.
+func buildBundle(source *Source, outputPath string, config *Config) error {
+	if !config.Bundle {
+		return nil
+	}
+
+	posts := slices.Clone(listedPosts(source))
+	slices.SortFunc(posts, comparePostsNewestFirst)
+
+	anchors := map[string]string{}
+	for _, post := range posts {
+		if post.Dir(config) == bundleDir {
+			return fmt.Errorf("post %s has the directory %s, which the bundle is written to", post.Name, bundleDir)
+		}
+		anchors[post.Dir(config)] = "post-" + FormatKey(post.Key, config)
+	}
+
+	doc := etree.NewDocument()
+	docRoot := doc.CreateElement("document")
+	meta := docRoot.CreateElement("meta")
+	meta.CreateElement("title").CreateAttr("value", config.SiteTitle)
+	body := docRoot.CreateElement("body")
+
+	for _, post := range posts {
+		pagePath := filepath.Join(outputPath, filepath.FromSlash(post.Dir(config)), "index.xml")
+		page := etree.NewDocument()
+		if err := page.ReadFromFile(pagePath); err != nil {
+			return fmt.Errorf("failed to read %s for the bundle: %w", pagePath, err)
+		}
+
+		anchor := anchors[post.Dir(config)]
+		title := body.CreateElement("bold")
+		title.CreateAttr("id", anchor)
+		title.CreateText(post.Title)
+
+		children := page.FindElements("/document/body/*")
+		// The page's own title is replaced by the one carrying the anchor.
+		if !post.BareLayout && len(children) > 0 && children[0].Tag == "bold" {
+			children = children[1:]
+		}
+		for _, child := range children {
+			child = child.Copy()
+			if err := bundleLinks(child, anchor, anchors, config); err != nil {
+				return fmt.Errorf("failed to bundle post %s: %w", post.Name, err)
+			}
+			body.AddChild(child)
+		}
+	}
+
+	if err := makeOutputDir(filepath.Join(outputPath, bundleDir), config); err != nil {
+		return fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+	if err := writePage(doc, filepath.Join(outputPath, bundleDir, "index.xml"), config); err != nil {
+		return fmt.Errorf("failed to write bundle index.xml: %w", err)
+	}
+	return nil
+}
+
+// bundleLinks rewrites the links below element for the bundle, and prefixes
+// footnote IDs with the post's anchor, since every post numbers its
+// footnotes from one.
+func bundleLinks(element *etree.Element, anchor string, anchors map[string]string, config *Config) error {
+	switch element.Tag {
+	case "link":
+		href, err := bundleHref(element.SelectAttrValue("href", ""), anchors, config)
+		if err != nil {
+			return err
+		}
+		element.CreateAttr("href", href)
+	case "footnote", "footnote-ref":
+		element.CreateAttr("id", anchor+"-"+element.SelectAttrValue("id", ""))
+	}
+
+	for _, child := range element.ChildElements() {
+		if err := bundleLinks(child, anchor, anchors, config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundleHref returns what a link to href points to in the bundle.
+func bundleHref(href string, anchors map[string]string, config *Config) (string, error) {
+	if !strings.HasPrefix(href, "/") || strings.HasPrefix(href, "//") {
+		return href, nil
+	}
+
+	path, _, _ := strings.Cut(href, "#")
+	path, _, _ = strings.Cut(path, "?")
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+
+	if anchor, ok := anchors[strings.Trim(path, "/")]; ok {
+		return "#" + anchor, nil
+	}
+
+	relPath := strings.TrimPrefix(path, "/")
+	staticPath := filepath.Join(staticsInputPath, filepath.FromSlash(relPath))
+	if info, err := os.Stat(staticPath); err == nil && !info.IsDir() && !config.Ignore.Matches(relPath, false) {
+		content, err := os.ReadFile(staticPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read static %s: %w", staticPath, err)
+		}
+		mediaType := mime.TypeByExtension(filepath.Ext(staticPath))
+		if mediaType == "" {
+			mediaType = "application/octet-stream"
+		}
+		return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(content), nil
+	}
+
+	if absolute := absoluteURL(href, config); absolute != "" {
+		return absolute, nil
+	}
+	return href, nil
+}
@@ -0,0 +1,77 @@
+package phetour
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Clean removes the output of the last build, every file its manifest
+// lists and the manifest itself. A file the manifest does not list means
+// the output path may point somewhere phetour never wrote to, so then
+// nothing at all is removed. A dry run lists what would be removed.
+func Clean(config *Config) error {
+	manifest, err := LoadManifest(config.OutputPath)
+	if err != nil {
+		return err
+	}
+	if manifest == nil {
+		if _, err := os.Stat(config.OutputPath); os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("refusing to clean %s: there is no %s telling which files phetour wrote", config.OutputPath, manifestFileName)
+	}
+
+	owned := manifest.Hashes()
+	var unknown []string
+	err = filepath.WalkDir(config.OutputPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(config.OutputPath, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		if _, ok := owned[relPath]; !ok && relPath != manifestFileName {
+			unknown = append(unknown, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list output files: %w", err)
+	}
+	if len(unknown) == 1 {
+		return fmt.Errorf("refusing to clean %s: %s was not written by phetour", config.OutputPath, unknown[0])
+	}
+	if len(unknown) > 1 {
+		return fmt.Errorf("refusing to clean %s: %s and %d other files were not written by phetour", config.OutputPath, unknown[0], len(unknown)-1)
+	}
+
+	var paths []string
+	for _, file := range manifest.Files {
+		path := filepath.Join(config.OutputPath, filepath.FromSlash(file.Path))
+		if _, err := os.Lstat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	paths = append(paths, filepath.Join(config.OutputPath, manifestFileName))
+
+	if config.DryRun {
+		for _, path := range paths {
+			fmt.Printf("would remove %s\n", path)
+		}
+		return nil
+	}
+
+	if err := removeStale(config.OutputPath, paths); err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(config.OutputPath); err == nil && len(entries) == 0 {
+		if err := os.Remove(config.OutputPath); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", config.OutputPath, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,436 @@
+package phetour
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	configFilePath = "./config.xml"
+)
+
+// defaultDirMode and defaultFileMode are the modes of the directories and
+// files phetour creates, unless dirMode and fileMode say otherwise.
+const (
+	defaultDirMode  os.FileMode = 0755
+	defaultFileMode os.FileMode = 0644
+)
+
+// IndentNone and IndentTabs are the Indent values for XML written without
+// indentation and indented with one tab per level; any other value counts
+// spaces.
+const (
+	IndentNone = etree.NoIndent
+	IndentTabs = -2
+)
+
+type Config struct {
+	ReadingSpeed       int
+	XSLTProcessor      string
+	XSLTCommand        string
+	SiteTitle          string
+	BaseURL            string
+	Params             map[string]string
+	Styles             map[string]StyleConfig
+	PrettyURLs         bool
+	Robots             *RobotsConfig
+	OutputPath         string
+	LockFile           string
+	PreviewPath        string
+	DryRun             bool
+	Strict             bool
+	Quiet              bool
+	AutoSlug           bool
+	NestSections       bool
+	PostsPaths         []string
+	DraftPrefix        string
+	PostExtensions     []string
+	Ignore             *IgnoreList
+	BuildTime          time.Time
+	Future             bool
+	Drafts             bool
+	Preview            bool
+	Converter          Converter
+	ParagraphConverter Converter
+	BodyElements       []string
+	PrimaryStyle       string
+	Force              bool
+	StylesOnly         bool
+	Indent             int
+	Menu               []MenuItem
+	HomeTags           bool
+	TagDescriptions    map[string]string
+	KeyWidth           int
+	KeyFormat          string
+	SearchIndex        bool
+	SearchIndexCode    bool
+	Bundle             bool
+	FeedLimit          int
+	CheckExternalLinks bool
+	HighlightTheme     string
+	SmartTypography    bool
+	DirMode            os.FileMode
+	FileMode           os.FileMode
+}
+
+type StyleConfig struct {
+	Extension string
+}
+
+// MenuItem is one link of the site menu every page carries.
+type MenuItem struct {
+	Label string
+	Href  string
+}
+
+type RobotsConfig struct {
+	Disallow []string
+	Sitemap  string
+}
+
+// defaultConfig returns the settings of a site without a config.xml,
+// which LoadConfig reads the file over.
+func defaultConfig() *Config {
+	return &Config{
+		ReadingSpeed:   200,
+		XSLTProcessor:  "external",
+		SiteTitle:      "փետուր",
+		OutputPath:     "./output",
+		PreviewPath:    "./preview",
+		LockFile:       defaultLockFile,
+		PostsPaths:     []string{postsPath},
+		DraftPrefix:    "~",
+		PostExtensions: []string{"", ".md", ".txt", ".ph"},
+		Converter:      PandocConverter{},
+		BodyElements:   slices.Clone(defaultBodyElements),
+		Params:         map[string]string{},
+		Styles:         map[string]StyleConfig{},
+		Indent:         4,
+		KeyWidth:       4,
+		KeyFormat:      "hex",
+		FeedLimit:      20,
+		DirMode:        defaultDirMode,
+		FileMode:       defaultFileMode,
+		Menu:           []MenuItem{{Label: "Home", Href: "/"}, {Label: "Tags", Href: pageHref(tagsIndexDir)}},
+	}
+}
+
+func LoadConfig() (*Config, error) {
+	config := defaultConfig()
+
+	buildTime, err := sourceDateEpoch()
+	if err != nil {
+		return nil, err
+	}
+	config.BuildTime = buildTime
+
+	ignore, err := LoadIgnore()
+	if err != nil {
+		return nil, err
+	}
+	config.Ignore = ignore
+
+	descriptions, err := LoadTagDescriptions()
+	if err != nil {
+		return nil, err
+	}
+	config.TagDescriptions = descriptions
+
+	if _, err := os.Stat(configFilePath); os.IsNotExist(err) {
+		return config, nil
+	}
+
+	configDocument := etree.NewDocument()
+	if err := configDocument.ReadFromFile(configFilePath); err != nil {
+		return nil, fmt.Errorf("failed reading config file: %w", err)
+	}
+
+	root := configDocument.SelectElement("config")
+	if root == nil {
+		return nil, fmt.Errorf("no config element found in config file")
+	}
+	if err := expandEnvAttrs(root); err != nil {
+		return nil, fmt.Errorf("failed reading config file: %w", err)
+	}
+
+	if err := readIntOption(root, "readingSpeed", &config.ReadingSpeed); err != nil {
+		return nil, err
+	}
+	if config.ReadingSpeed <= 0 {
+		return nil, fmt.Errorf("readingSpeed must be positive, got %d", config.ReadingSpeed)
+	}
+
+	if err := readIntOption(root, "feedLimit", &config.FeedLimit); err != nil {
+		return nil, err
+	}
+	if err := readModeOption(root, "dirMode", &config.DirMode); err != nil {
+		return nil, err
+	}
+	if err := readModeOption(root, "fileMode", &config.FileMode); err != nil {
+		return nil, err
+	}
+	if err := readIntOption(root, "keyWidth", &config.KeyWidth); err != nil {
+		return nil, err
+	}
+	if config.KeyWidth <= 0 {
+		return nil, fmt.Errorf("keyWidth must be positive, got %d", config.KeyWidth)
+	}
+	readStringOption(root, "keyFormat", &config.KeyFormat)
+	if !slices.Contains([]string{"hex", "decimal", "base36", "hashed"}, config.KeyFormat) {
+		return nil, fmt.Errorf("unknown keyFormat '%s': use hex, decimal, base36 or hashed", config.KeyFormat)
+	}
+
+	readStringOption(root, "highlightTheme", &config.HighlightTheme)
+	if _, known := highlightThemes[config.HighlightTheme]; config.HighlightTheme != "" && !known {
+		return nil, fmt.Errorf("unknown highlightTheme '%s': use %s", config.HighlightTheme, strings.Join(highlightThemeNames(), ", "))
+	}
+
+	readStringOption(root, "xsltProcessor", &config.XSLTProcessor)
+	readStringOption(root, "xsltCommand", &config.XSLTCommand)
+	readStringOption(root, "siteTitle", &config.SiteTitle)
+	readStringOption(root, "baseURL", &config.BaseURL)
+	pandoc := PandocConverter{Format: defaultPandocFormat}
+	if element := root.SelectElement("tempDir"); element != nil {
+		pandoc.TempDir = element.SelectAttrValue("value", "")
+		if info, err := os.Stat(pandoc.TempDir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("tempDir '%s' is not a directory", pandoc.TempDir)
+		}
+	}
+	readStringOption(root, "markdownFlavor", &pandoc.Format)
+	if !validMarkdownFlavor(pandoc.Format) {
+		return nil, fmt.Errorf("unknown markdownFlavor '%s': use %s, optionally with +extension or -extension", pandoc.Format, strings.Join(markdownFlavors, ", "))
+	}
+	config.Converter = pandoc
+	if element := root.SelectElement("paragraphs"); element != nil {
+		switch value := element.SelectAttrValue("value", ""); value {
+		case "raw":
+		case "markdown":
+			// Smart punctuation is left to smartTypography, which sees the
+			// whole post rather than one paragraph at a time.
+			paragraphs := pandoc
+			paragraphs.Format += "-smart"
+			config.ParagraphConverter = paragraphs
+		default:
+			return nil, fmt.Errorf("unknown paragraphs '%s': use raw or markdown", value)
+		}
+	}
+	if element := root.SelectElement("draftPrefix"); element != nil {
+		config.DraftPrefix = element.SelectAttrValue("value", "")
+	}
+	if element := root.SelectElement("postsPaths"); element != nil {
+		config.PostsPaths = strings.Fields(element.SelectAttrValue("value", ""))
+		if len(config.PostsPaths) == 0 {
+			return nil, fmt.Errorf("postsPaths must name at least one folder")
+		}
+	}
+	if element := root.SelectElement("postExtensions"); element != nil {
+		config.PostExtensions = nil
+		for _, extension := range strings.Fields(element.SelectAttrValue("value", "")) {
+			// A lone "." stands for files without an extension.
+			if extension == "." {
+				extension = ""
+			} else if !strings.HasPrefix(extension, ".") {
+				extension = "." + extension
+			}
+			config.PostExtensions = append(config.PostExtensions, strings.ToLower(extension))
+		}
+	}
+	if element := root.SelectElement("indent"); element != nil {
+		value := element.SelectAttrValue("value", "")
+		switch value {
+		case "none":
+			config.Indent = IndentNone
+		case "tab":
+			config.Indent = IndentTabs
+		default:
+			spaces, err := strconv.Atoi(value)
+			if err != nil || spaces < 0 {
+				return nil, fmt.Errorf("invalid value '%s' for indent in config file: use a number of spaces, tab or none", value)
+			}
+			config.Indent = spaces
+		}
+	}
+	readStringOption(root, "primaryStyle", &config.PrimaryStyle)
+	readStringOption(root, "outputPath", &config.OutputPath)
+	if config.OutputPath == "" {
+		return nil, fmt.Errorf("outputPath must not be empty")
+	}
+	readStringOption(root, "lockFile", &config.LockFile)
+	if config.LockFile == "" {
+		return nil, fmt.Errorf("lockFile must not be empty")
+	}
+	readStringOption(root, "previewPath", &config.PreviewPath)
+	if config.PreviewPath == "" {
+		return nil, fmt.Errorf("previewPath must not be empty")
+	}
+	if err := readBoolOption(root, "prettyURLs", &config.PrettyURLs); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "strict", &config.Strict); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "quiet", &config.Quiet); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "nestSections", &config.NestSections); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "autoSlug", &config.AutoSlug); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "future", &config.Future); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "homeTags", &config.HomeTags); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "bundle", &config.Bundle); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "searchIndex", &config.SearchIndex); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "searchIndexCode", &config.SearchIndexCode); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "checkExternalLinks", &config.CheckExternalLinks); err != nil {
+		return nil, err
+	}
+	if err := readBoolOption(root, "smartTypography", &config.SmartTypography); err != nil {
+		return nil, err
+	}
+
+	for _, paramElement := range root.SelectElements("param") {
+		name := paramElement.SelectAttrValue("name", "")
+		if name == "" {
+			return nil, fmt.Errorf("param element with empty name found in config file")
+		}
+		config.Params[name] = paramElement.SelectAttrValue("value", "")
+	}
+
+	for _, bodyElement := range root.SelectElements("bodyElement") {
+		name := bodyElement.SelectAttrValue("name", "")
+		if name == "" {
+			return nil, fmt.Errorf("bodyElement element with empty name found in config file")
+		}
+		if !slices.Contains(config.BodyElements, name) {
+			config.BodyElements = append(config.BodyElements, name)
+		}
+	}
+
+	for _, styleElement := range root.SelectElements("style") {
+		name := styleElement.SelectAttrValue("name", "")
+		if name == "" {
+			return nil, fmt.Errorf("style element with empty name found in config file")
+		}
+		config.Styles[name] = StyleConfig{
+			Extension: strings.TrimPrefix(styleElement.SelectAttrValue("extension", ""), "."),
+		}
+	}
+
+	// A menu replaces the default one as a whole; an empty one removes it.
+	if menuElement := root.SelectElement("menu"); menuElement != nil {
+		config.Menu = nil
+		for _, itemElement := range menuElement.SelectElements("item") {
+			item := MenuItem{
+				Label: itemElement.SelectAttrValue("label", ""),
+				Href:  itemElement.SelectAttrValue("href", ""),
+			}
+			if item.Label == "" || item.Href == "" {
+				return nil, fmt.Errorf("menu item without label or href found in config file")
+			}
+			config.Menu = append(config.Menu, item)
+		}
+	}
+
+	if robotsElement := root.SelectElement("robots"); robotsElement != nil {
+		config.Robots = &RobotsConfig{}
+		for _, disallowElement := range robotsElement.SelectElements("disallow") {
+			path := disallowElement.SelectAttrValue("value", "")
+			if path == "" {
+				return nil, fmt.Errorf("disallow element with empty value found in config file")
+			}
+			config.Robots.Disallow = append(config.Robots.Disallow, path)
+		}
+		readStringOption(robotsElement, "sitemap", &config.Robots.Sitemap)
+	}
+
+	return config, nil
+}
+
+// sourceDateEpoch returns the time given in SOURCE_DATE_EPOCH, so that
+// rebuilding unchanged input yields byte-identical output, or the current
+// time when the variable is not set.
+func sourceDateEpoch() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now().UTC(), nil
+	}
+
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH '%s': %w", epoch, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+func readStringOption(root *etree.Element, name string, target *string) {
+	if element := root.SelectElement(name); element != nil {
+		*target = element.SelectAttrValue("value", "")
+	}
+}
+
+func readBoolOption(root *etree.Element, name string, target *bool) error {
+	element := root.SelectElement(name)
+	if element == nil {
+		return nil
+	}
+
+	valueString := element.SelectAttrValue("value", "")
+	value, err := strconv.ParseBool(valueString)
+	if err != nil {
+		return fmt.Errorf("invalid value '%s' for %s in config file: %w", valueString, name, err)
+	}
+
+	*target = value
+	return nil
+}
+
+// readModeOption reads permission bits written in octal, like 0750.
+func readModeOption(root *etree.Element, name string, target *os.FileMode) error {
+	element := root.SelectElement(name)
+	if element == nil {
+		return nil
+	}
+
+	valueString := element.SelectAttrValue("value", "")
+	value, err := strconv.ParseUint(valueString, 8, 32)
+	if err != nil || value > 0777 {
+		return fmt.Errorf("invalid value '%s' for %s in config file: use octal permission bits, like 0755", valueString, name)
+	}
+
+	*target = os.FileMode(value)
+	return nil
+}
+
+func readIntOption(root *etree.Element, name string, target *int) error {
+	element := root.SelectElement(name)
+	if element == nil {
+		return nil
+	}
+
+	valueString := element.SelectAttrValue("value", "")
+	value, err := strconv.Atoi(valueString)
+	if err != nil {
+		return fmt.Errorf("invalid value '%s' for %s in config file: %w", valueString, name, err)
+	}
+
+	*target = value
+	return nil
+}
@@ -0,0 +1,116 @@
+package phetour
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+
+	"github.com/beevik/etree"
+)
+
+// Converter turns the Markdown of a code block, or of a paragraph, into an
+// HTML fragment, held by the root element of the returned document. When
+// it fails, the block is kept as plain code, or the paragraph as raw text.
+// Parsing goes through Config.Converter and Config.ParagraphConverter, so a
+// test can swap pandoc for a fake.
+type Converter interface {
+	Convert(markdown string) (*etree.Document, error)
+}
+
+// converterChecker is implemented by converters that depend on something
+// outside phetour, so that its absence is reported once at the start of a
+// build instead of being found out block by block.
+type converterChecker interface {
+	Check() error
+}
+
+// checkConverter warns when the converter cannot run, since every code
+// block then stays plain code, and every paragraph raw text when they are
+// meant to be Markdown, without saying why.
+func checkConverter(config *Config) []string {
+	checker, ok := config.Converter.(converterChecker)
+	if !ok {
+		return nil
+	}
+	if err := checker.Check(); err != nil {
+		if config.ParagraphConverter != nil {
+			return []string{fmt.Sprintf("%v: code blocks are kept as plain code, tables included, and paragraphs as raw text", err)}
+		}
+		return []string{fmt.Sprintf("%v: code blocks are kept as plain code, tables included", err)}
+	}
+	return nil
+}
+
+// defaultPandocFormat is the Markdown flavor pandoc reads unless the
+// markdownFlavor setting names another.
+const defaultPandocFormat = "markdown"
+
+// markdownFlavors are the Markdown input formats of pandoc. Any other
+// format would read code blocks as something else altogether.
+var markdownFlavors = []string{"markdown", "gfm", "commonmark", "commonmark_x", "markdown_strict", "markdown_phpextra", "markdown_mmd"}
+
+// pandocFormatPattern matches a pandoc input format, optionally with
+// extensions turned on or off, like gfm or markdown_strict+pipe_tables.
+var pandocFormatPattern = regexp.MustCompile(`^([a-z_]+)([+-][a-z_]+)*$`)
+
+// validMarkdownFlavor reports whether format is one of markdownFlavors,
+// with or without extensions.
+func validMarkdownFlavor(format string) bool {
+	match := pandocFormatPattern.FindStringSubmatch(format)
+	return match != nil && slices.Contains(markdownFlavors, match[1])
+}
+
+// PandocConverter runs the pandoc binary, reading Format, or Pandoc's own
+// Markdown when Format is empty. Its input goes through a temporary file in
+// TempDir, or in the system's temporary directory when TempDir is empty.
+type PandocConverter struct {
+	TempDir string
+	Format  string
+}
+
+// Check reports whether pandoc can be found in the PATH.
+func (PandocConverter) Check() error {
+	if _, err := exec.LookPath("pandoc"); err != nil {
+		return fmt.Errorf("pandoc not found")
+	}
+	return nil
+}
+
+func (converter PandocConverter) Convert(markdown string) (*etree.Document, error) {
+	tmpFile, err := os.CreateTemp(converter.TempDir, "pandoc-input-*.md")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	// The file is removed however pandoc ends, crashing included, since
+	// only phetour knows it is there.
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.WriteString(markdown)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	format := converter.Format
+	if format == "" {
+		format = defaultPandocFormat
+	}
+	cmd := exec.Command("pandoc", tmpFile.Name(), "-f", format, "-t", "html")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("pandoc failed: %s", string(output))
+	}
+
+	// Pandoc writes a fragment, often several elements side by side, so it
+	// is wrapped before being read as XML. Output that still is not XML,
+	// like a stray <int> in C++ read as a tag, fails the conversion.
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString("<fragment>" + string(output) + "</fragment>"); err != nil {
+		return nil, fmt.Errorf("pandoc output is not XML: %w", err)
+	}
+	return doc, nil
+}
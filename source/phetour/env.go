@@ -0,0 +1,67 @@
+package phetour
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// envPattern matches a ${NAME} reference to an environment variable.
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces every ${NAME} in value with that variable of the
+// process environment. An unset variable is an error rather than an empty
+// string, so that a deploy missing one does not quietly publish a broken
+// site.
+func expandEnv(value string) (string, error) {
+	var missing []string
+	expanded := envPattern.ReplaceAllStringFunc(value, func(reference string) string {
+		name := envPattern.FindStringSubmatch(reference)[1]
+		variable, ok := os.LookupEnv(name)
+		if !ok && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+		return variable
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined environment variable %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// expandEnvAttrs expands the attribute values of element and of every
+// element inside it.
+func expandEnvAttrs(element *etree.Element) error {
+	for i, attr := range element.Attr {
+		value, err := expandEnv(attr.Value)
+		if err != nil {
+			return fmt.Errorf("%s of %s: %w", attr.Key, element.Tag, err)
+		}
+		element.Attr[i].Value = value
+	}
+	for _, child := range element.ChildElements() {
+		if err := expandEnvAttrs(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandConfig returns the content of config.xml with its references to
+// environment variables expanded, as LoadConfig reads it.
+func expandConfig(content []byte) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(content); err != nil {
+		return nil, err
+	}
+	if root := doc.Root(); root != nil {
+		if err := expandEnvAttrs(root); err != nil {
+			return nil, err
+		}
+	}
+	return doc.WriteToBytes()
+}
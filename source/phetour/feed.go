@@ -0,0 +1,214 @@
+package phetour
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	atomNamespace = "http://www.w3.org/2005/Atom"
+)
+
+// feedEntry is what both feeds say about a post.
+type feedEntry struct {
+	ID        string
+	Title     string
+	URL       string
+	Summary   string
+	Author    string
+	Tags      []string
+	Published time.Time
+	Updated   time.Time
+}
+
+// feedChannel is what a feed says about itself: its title, the page it
+// stands for and its own location, both as paths from the site root.
+type feedChannel struct {
+	Title string
+	Page  string
+	Self  string
+}
+
+// feedID is the permanent identifier of a post in the feeds. It is built
+// from the key, written in hex whatever keyFormat says, so that neither a
+// slug nor a change of key format makes readers see the post as new.
+func feedID(key int, config *Config) string {
+	return absoluteURL(fmt.Sprintf("/0x%04x", key), config)
+}
+
+// feedDate is the time a post is sorted by in the feeds: its date, or the
+// modification time of its source file when it has none.
+func feedDate(post Post) time.Time {
+	if post.Date.IsZero() {
+		return post.Modified
+	}
+	return post.Date
+}
+
+// buildFeeds writes rss.xml and atom.xml next to the generated XML, both
+// from the same entries, and an RSS feed.xml into the directory of every
+// tag, holding only the posts with that tag. Feed readers need absolute
+// URLs, so nothing is written without a baseURL.
+func buildFeeds(source *Source, taxonomy *Taxonomy, outputPath string, config *Config) error {
+	if config.BaseURL == "" {
+		return nil
+	}
+
+	entries, updated := feedEntries(listedPosts(source), taxonomy, config)
+	site := feedChannel{Title: config.SiteTitle, Page: "/", Self: "/rss.xml"}
+	if err := writeDocument(buildRSS(site, entries, updated, config), filepath.Join(outputPath, "rss.xml"), config); err != nil {
+		return fmt.Errorf("failed to write rss.xml: %w", err)
+	}
+	site.Self = "/atom.xml"
+	if err := writeDocument(buildAtom(site, entries, updated, config), filepath.Join(outputPath, "atom.xml"), config); err != nil {
+		return fmt.Errorf("failed to write atom.xml: %w", err)
+	}
+
+	for _, tag := range taxonomy.Tags {
+		var posts []Post
+		for _, post := range source.Posts {
+			if tag.Mentioned(post.Key) {
+				posts = append(posts, post)
+			}
+		}
+		entries, updated := feedEntries(posts, taxonomy, config)
+		dir := FormatKey(tag.Key, config)
+		channel := feedChannel{
+			Title: config.SiteTitle + ": " + tag.Label,
+			Page:  pageHref(dir),
+			Self:  pageHref(dir) + "feed.xml",
+		}
+		if err := writeDocument(buildRSS(channel, entries, updated, config), filepath.Join(outputPath, dir, "feed.xml"), config); err != nil {
+			return fmt.Errorf("failed to write feed of tag %s: %w", tag.Label, err)
+		}
+	}
+	return nil
+}
+
+// feedEntries turns posts into feed entries: the feedLimit most recent,
+// newest first, or all of them when feedLimit is not positive. It also
+// returns the time the latest of them was updated.
+func feedEntries(posts []Post, taxonomy *Taxonomy, config *Config) ([]feedEntry, time.Time) {
+	posts = slices.Clone(posts)
+	slices.SortFunc(posts, comparePostsNewestFirst)
+	if config.FeedLimit > 0 && len(posts) > config.FeedLimit {
+		posts = posts[:config.FeedLimit]
+	}
+
+	var entries []feedEntry
+	var updated time.Time
+	for _, post := range posts {
+		entry := feedEntry{
+			ID:        feedID(post.Key, config),
+			Title:     post.Title,
+			URL:       absoluteURL(pageHref(post.Dir(config)), config),
+			Summary:   post.Summary,
+			Author:    post.Author,
+			Published: post.Date,
+			Updated:   lastUpdate(post),
+		}
+		for _, tag := range taxonomy.TagsOf(post) {
+			entry.Tags = append(entry.Tags, tag.Label)
+		}
+		if entry.Updated.After(updated) {
+			updated = entry.Updated
+		}
+		entries = append(entries, entry)
+	}
+	return entries, updated
+}
+
+// buildRSS renders the entries as an RSS 2.0 channel. The guid is the
+// same identifier the Atom feed uses.
+func buildRSS(channel feedChannel, entries []feedEntry, updated time.Time, config *Config) *etree.Document {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	rss := doc.CreateElement("rss")
+	rss.CreateAttr("version", "2.0")
+	rss.CreateAttr("xmlns:atom", atomNamespace)
+
+	element := rss.CreateElement("channel")
+	element.CreateElement("title").CreateText(channel.Title)
+	element.CreateElement("link").CreateText(absoluteURL(channel.Page, config))
+	element.CreateElement("description").CreateText(channel.Title)
+	self := element.CreateElement("atom:link")
+	self.CreateAttr("href", absoluteURL(channel.Self, config))
+	self.CreateAttr("rel", "self")
+	self.CreateAttr("type", "application/rss+xml")
+	if !updated.IsZero() {
+		element.CreateElement("lastBuildDate").CreateText(updated.UTC().Format(time.RFC1123Z))
+	}
+
+	for _, entry := range entries {
+		item := element.CreateElement("item")
+		item.CreateElement("title").CreateText(entry.Title)
+		item.CreateElement("link").CreateText(entry.URL)
+		guid := item.CreateElement("guid")
+		guid.CreateAttr("isPermaLink", "false")
+		guid.CreateText(entry.ID)
+		if entry.Summary != "" {
+			item.CreateElement("description").CreateText(entry.Summary)
+		}
+		for _, tag := range entry.Tags {
+			item.CreateElement("category").CreateText(tag)
+		}
+		published := entry.Published
+		if published.IsZero() {
+			published = entry.Updated
+		}
+		item.CreateElement("pubDate").CreateText(published.UTC().Format(time.RFC1123Z))
+	}
+
+	return doc
+}
+
+// buildAtom renders the entries as an Atom feed. The site title stands in
+// as the author of posts that name none, since Atom requires one.
+func buildAtom(channel feedChannel, entries []feedEntry, updated time.Time, config *Config) *etree.Document {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	feed := doc.CreateElement("feed")
+	feed.CreateAttr("xmlns", atomNamespace)
+
+	feed.CreateElement("id").CreateText(absoluteURL(channel.Page, config))
+	feed.CreateElement("title").CreateText(channel.Title)
+	if updated.IsZero() {
+		updated = config.BuildTime
+	}
+	feed.CreateElement("updated").CreateText(updated.UTC().Format(time.RFC3339))
+	feed.CreateElement("author").CreateElement("name").CreateText(config.SiteTitle)
+	addAtomLink(feed, "alternate", absoluteURL(channel.Page, config))
+	addAtomLink(feed, "self", absoluteURL(channel.Self, config))
+
+	for _, entry := range entries {
+		element := feed.CreateElement("entry")
+		element.CreateElement("id").CreateText(entry.ID)
+		element.CreateElement("title").CreateText(entry.Title)
+		addAtomLink(element, "alternate", entry.URL)
+		element.CreateElement("updated").CreateText(entry.Updated.UTC().Format(time.RFC3339))
+		if !entry.Published.IsZero() {
+			element.CreateElement("published").CreateText(entry.Published.UTC().Format(time.RFC3339))
+		}
+		if entry.Author != "" {
+			element.CreateElement("author").CreateElement("name").CreateText(entry.Author)
+		}
+		if entry.Summary != "" {
+			element.CreateElement("summary").CreateText(entry.Summary)
+		}
+		for _, tag := range entry.Tags {
+			element.CreateElement("category").CreateAttr("term", tag)
+		}
+	}
+
+	return doc
+}
+
+func addAtomLink(parent *etree.Element, rel, href string) {
+	link := parent.CreateElement("link")
+	link.CreateAttr("rel", rel)
+	link.CreateAttr("href", href)
+}
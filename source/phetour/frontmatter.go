@@ -0,0 +1,355 @@
+package phetour
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Posts brought over from other generators may keep their front matter,
+// TOML between +++ lines or a JSON object, in place of the custom header.
+// It holds the same fields and gives the same meta; the body that follows
+// is written in the custom syntax either way.
+
+const tomlDelimiter = "+++"
+
+// frontMatterField is one field of a front matter, with the line it was
+// found on for error messages. Arrays may hold any number of values, other
+// fields exactly one.
+type frontMatterField struct {
+	Name   string
+	Values []string
+	Array  bool
+	Line   int
+}
+
+// parseFrontMatterDocument parses a post starting with front matter, its
+// kind told by the first non-blank line: +++ for TOML, { for JSON.
+func parseFrontMatterDocument(content string, filePath string, converter Converter, paragraphs Converter) (*etree.Document, error) {
+	lines := strings.Split(content, "\n")
+	first := 0
+	for first < len(lines) && strings.TrimSpace(lines[first]) == "" {
+		first++
+	}
+
+	var fields []frontMatterField
+	var bodyStart int
+	var err error
+	if strings.TrimSpace(lines[first]) == tomlDelimiter {
+		fields, bodyStart, err = parseTOMLFrontMatter(lines, first, filePath)
+	} else {
+		fields, bodyStart, err = parseJSONFrontMatter(content, filePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	title, tags, metaFields, errs := frontMatterMeta(fields, filePath)
+
+	doc, body := newPostDocument(title, tags, metaFields)
+	if err := parseContent(lines, bodyStart, body, filePath, converter, paragraphs); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return doc, nil
+}
+
+// frontMatterMeta sorts the fields of a front matter into the title, the
+// tags and the header fields of the custom syntax.
+func frontMatterMeta(fields []frontMatterField, filePath string) (headerField, []string, []headerField, []error) {
+	title := headerField{Name: "title"}
+	var tags []string
+	var metaFields []headerField
+	var errs []error
+	var seen []string
+
+	for _, field := range fields {
+		fail := func(format string, args ...any) {
+			errs = append(errs, &ParseError{Path: filePath, Line: field.Line, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if slices.Contains(seen, field.Name) {
+			fail("%s is set twice", field.Name)
+			continue
+		}
+		seen = append(seen, field.Name)
+
+		if field.Name == "tags" {
+			for _, label := range field.Values {
+				if label = strings.TrimSpace(label); label == "" {
+					fail("empty tag")
+				} else {
+					tags = append(tags, label)
+				}
+			}
+			continue
+		}
+
+		if field.Name != "title" && !slices.Contains(headerFields, field.Name) {
+			fail("unknown field %s: use title, tags, %s", field.Name, strings.Join(headerFields, ", "))
+			continue
+		}
+		if field.Array {
+			fail("%s must be a single value, not a list", field.Name)
+			continue
+		}
+		value := strings.TrimSpace(field.Values[0])
+		switch {
+		case value == "" && field.Name == "title":
+			fail("empty title")
+		case value == "":
+			fail("empty value for %s", field.Name)
+		case field.Name == "title":
+			title.Value, title.Line = value, field.Line
+		default:
+			metaFields = append(metaFields, headerField{Name: field.Name, Value: value, Line: field.Line})
+		}
+	}
+
+	if !slices.Contains(seen, "title") {
+		errs = append(errs, &ParseError{Path: filePath, Message: "no title found in front matter"})
+	}
+
+	return title, tags, metaFields, errs
+}
+
+// tomlKeyPattern matches the bare keys front matter fields are named with.
+var tomlKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// errUnterminatedArray is returned for an array continued on the next line.
+var errUnterminatedArray = errors.New("unterminated array")
+
+// parseTOMLFrontMatter reads the TOML front matter opened at line first,
+// returning its fields and the line the body starts at. Only what front
+// matter needs is understood: keys set to strings, bare values like dates,
+// numbers and booleans, and arrays of them, which may span lines.
+func parseTOMLFrontMatter(lines []string, first int, filePath string) ([]frontMatterField, int, error) {
+	var fields []frontMatterField
+	var errs []error
+
+	i := first + 1
+	for ; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == tomlDelimiter {
+			break
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			errs = append(errs, &ParseError{Path: filePath, Line: i + 1, Message: "tables are not supported in front matter"})
+			continue
+		}
+
+		key, valueText, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !tomlKeyPattern.MatchString(key) {
+			errs = append(errs, &ParseError{Path: filePath, Line: i + 1, Message: "expected key = value"})
+			continue
+		}
+
+		start := i
+		values, array, err := parseTOMLValue(valueText)
+		for errors.Is(err, errUnterminatedArray) && i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != tomlDelimiter {
+			i++
+			valueText += " " + lines[i]
+			values, array, err = parseTOMLValue(valueText)
+		}
+		if err != nil {
+			errs = append(errs, &ParseError{Path: filePath, Line: start + 1, Message: fmt.Sprintf("invalid value for %s: %v", key, err)})
+			continue
+		}
+		fields = append(fields, frontMatterField{Name: key, Values: values, Array: array, Line: start + 1})
+	}
+
+	if i >= len(lines) {
+		return nil, 0, &ParseError{Path: filePath, Line: first + 1, Message: "front matter is never closed with " + tomlDelimiter}
+	}
+	if len(errs) > 0 {
+		return nil, 0, errors.Join(errs...)
+	}
+	return fields, i + 1, nil
+}
+
+// parseTOMLValue reads the value of a key, which may be followed by
+// nothing but a comment.
+func parseTOMLValue(text string) ([]string, bool, error) {
+	rest := strings.TrimSpace(text)
+	var values []string
+	array := strings.HasPrefix(rest, "[")
+
+	if array {
+		rest = strings.TrimSpace(rest[1:])
+		for !strings.HasPrefix(rest, "]") {
+			if rest == "" {
+				return nil, false, errUnterminatedArray
+			}
+			var value string
+			var err error
+			value, rest, err = parseTOMLScalar(rest)
+			if err != nil {
+				return nil, false, err
+			}
+			values = append(values, value)
+			rest = strings.TrimSpace(rest)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") && rest != "" {
+				return nil, false, fmt.Errorf("expected , or ] in array")
+			}
+		}
+		rest = rest[1:]
+	} else {
+		value, remaining, err := parseTOMLScalar(rest)
+		if err != nil {
+			return nil, false, err
+		}
+		values = append(values, value)
+		rest = remaining
+	}
+
+	if rest = strings.TrimSpace(rest); rest != "" && !strings.HasPrefix(rest, "#") {
+		return nil, false, fmt.Errorf("unexpected %q after the value", rest)
+	}
+	return values, array, nil
+}
+
+// parseTOMLScalar reads one string or bare value from the start of text
+// and returns it with what follows it.
+func parseTOMLScalar(text string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		for end := 1; end < len(text); end++ {
+			switch text[end] {
+			case '\\':
+				end++
+			case '"':
+				value, err := strconv.Unquote(text[:end+1])
+				if err != nil {
+					return "", "", fmt.Errorf("invalid string %s", text[:end+1])
+				}
+				return value, text[end+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string")
+
+	case strings.HasPrefix(text, "'"):
+		value, rest, found := strings.Cut(text[1:], "'")
+		if !found {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return value, rest, nil
+
+	default:
+		end := strings.IndexAny(text, ",]#")
+		if end < 0 {
+			end = len(text)
+		}
+		value := strings.TrimSpace(text[:end])
+		if value == "" {
+			return "", "", fmt.Errorf("missing value")
+		}
+		return value, text[end:], nil
+	}
+}
+
+// parseJSONFrontMatter reads the JSON object a post starts with, returning
+// its fields and the line the body starts at. Values are strings, numbers,
+// booleans, or arrays of them.
+func parseJSONFrontMatter(content string, filePath string) ([]frontMatterField, int, error) {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+	lineAt := func() int {
+		return strings.Count(content[:decoder.InputOffset()], "\n") + 1
+	}
+	fail := func(message string) error {
+		return &ParseError{Path: filePath, Line: lineAt(), Message: message}
+	}
+
+	readScalar := func(token json.Token) (string, bool) {
+		switch value := token.(type) {
+		case string:
+			return value, true
+		case json.Number:
+			return value.String(), true
+		case bool:
+			return strconv.FormatBool(value), true
+		}
+		return "", false
+	}
+
+	next := func() (json.Token, error) {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fail("front matter is never closed with }")
+		}
+		if err != nil {
+			return nil, fail("invalid front matter: " + err.Error())
+		}
+		return token, nil
+	}
+
+	if _, err := next(); err != nil {
+		return nil, 0, err
+	}
+
+	var fields []frontMatterField
+	for decoder.More() {
+		token, err := next()
+		if err != nil {
+			return nil, 0, err
+		}
+		field := frontMatterField{Name: token.(string), Line: lineAt()}
+
+		token, err = next()
+		if err != nil {
+			return nil, 0, err
+		}
+		if token == json.Delim('[') {
+			field.Array = true
+			for decoder.More() {
+				token, err := next()
+				if err != nil {
+					return nil, 0, err
+				}
+				value, ok := readScalar(token)
+				if !ok {
+					return nil, 0, fail(fmt.Sprintf("%s may only hold strings, numbers and booleans", field.Name))
+				}
+				field.Values = append(field.Values, value)
+			}
+			if _, err := next(); err != nil {
+				return nil, 0, err
+			}
+		} else {
+			value, ok := readScalar(token)
+			if !ok {
+				return nil, 0, fail(fmt.Sprintf("%s must be a string, a number, a boolean or a list", field.Name))
+			}
+			field.Values = []string{value}
+		}
+		fields = append(fields, field)
+	}
+	if _, err := next(); err != nil {
+		return nil, 0, err
+	}
+
+	// The body starts on the line after the closing brace, which must be
+	// the last thing on its line.
+	end := int(decoder.InputOffset())
+	rest, _, _ := strings.Cut(content[end:], "\n")
+	if strings.TrimSpace(rest) != "" {
+		return nil, 0, fail("unexpected text after the front matter")
+	}
+	return fields, lineAt(), nil
+}
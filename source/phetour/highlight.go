@@ -0,0 +1,188 @@
+package phetour
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const highlightFileName = "highlight.css"
+
+// highlightTheme styles the token classes pandoc puts on the spans of a
+// highlighted code block: kw for keywords, st for strings, co for comments
+// and so on. Background and Color apply to the block as a whole.
+type highlightTheme struct {
+	Background string
+	Color      string
+	Tokens     map[string]string
+}
+
+// highlightThemes are the themes highlightTheme may name, after the pandoc
+// styles of the same names.
+var highlightThemes = map[string]highlightTheme{
+	"pygments": {
+		Tokens: map[string]string{
+			"al": "color: #ff0000; font-weight: bold;",
+			"an": "color: #60a0b0; font-weight: bold; font-style: italic;",
+			"at": "color: #7d9029;",
+			"bn": "color: #40a070;",
+			"bu": "color: #008000;",
+			"cf": "color: #007020; font-weight: bold;",
+			"ch": "color: #4070a0;",
+			"cn": "color: #880000;",
+			"co": "color: #60a0b0; font-style: italic;",
+			"cv": "color: #60a0b0; font-weight: bold; font-style: italic;",
+			"do": "color: #ba2121; font-style: italic;",
+			"dt": "color: #902000;",
+			"dv": "color: #40a070;",
+			"er": "color: #ff0000; font-weight: bold;",
+			"fl": "color: #40a070;",
+			"fu": "color: #06287e;",
+			"im": "color: #008000; font-weight: bold;",
+			"in": "color: #60a0b0; font-weight: bold; font-style: italic;",
+			"kw": "color: #007020; font-weight: bold;",
+			"op": "color: #666666;",
+			"ot": "color: #007020;",
+			"pp": "color: #bc7a00;",
+			"sc": "color: #4070a0;",
+			"ss": "color: #bb6688;",
+			"st": "color: #4070a0;",
+			"va": "color: #19177c;",
+			"vs": "color: #4070a0;",
+			"wa": "color: #60a0b0; font-weight: bold; font-style: italic;",
+		},
+	},
+	"tango": {
+		Background: "#f8f8f8",
+		Tokens: map[string]string{
+			"al": "color: #ef2929;",
+			"an": "color: #8f5902; font-weight: bold; font-style: italic;",
+			"at": "color: #c4a000;",
+			"bn": "color: #0000cf;",
+			"cf": "color: #204a87; font-weight: bold;",
+			"ch": "color: #4e9a06;",
+			"cn": "color: #000000;",
+			"co": "color: #8f5902; font-style: italic;",
+			"cv": "color: #8f5902; font-weight: bold; font-style: italic;",
+			"do": "color: #8f5902; font-weight: bold; font-style: italic;",
+			"dt": "color: #204a87;",
+			"dv": "color: #0000cf;",
+			"er": "color: #a40000; font-weight: bold;",
+			"fl": "color: #0000cf;",
+			"fu": "color: #204a87; font-weight: bold;",
+			"in": "color: #8f5902; font-weight: bold; font-style: italic;",
+			"kw": "color: #204a87; font-weight: bold;",
+			"op": "color: #ce5c00; font-weight: bold;",
+			"ot": "color: #8f5902;",
+			"pp": "color: #8f5902; font-style: italic;",
+			"sc": "color: #ce5c00; font-weight: bold;",
+			"ss": "color: #4e9a06;",
+			"st": "color: #4e9a06;",
+			"va": "color: #000000;",
+			"vs": "color: #4e9a06;",
+			"wa": "color: #8f5902; font-weight: bold; font-style: italic;",
+		},
+	},
+	"monochrome": {
+		Tokens: map[string]string{
+			"al": "font-weight: bold;",
+			"an": "font-style: italic;",
+			"cf": "font-weight: bold;",
+			"co": "font-style: italic;",
+			"cv": "font-style: italic;",
+			"do": "font-style: italic;",
+			"dt": "text-decoration: underline;",
+			"er": "font-weight: bold;",
+			"im": "font-weight: bold;",
+			"in": "font-style: italic;",
+			"kw": "font-weight: bold;",
+			"pp": "font-weight: bold;",
+			"wa": "font-style: italic;",
+		},
+	},
+	"breezedark": {
+		Background: "#232629",
+		Color:      "#cfcfc2",
+		Tokens: map[string]string{
+			"al": "color: #95da4c; background-color: #4d1f24; font-weight: bold;",
+			"an": "color: #3f8058;",
+			"at": "color: #2980b9;",
+			"bn": "color: #f67400;",
+			"bu": "color: #7f8c8d;",
+			"cf": "color: #fdbc4b; font-weight: bold;",
+			"ch": "color: #3daee9;",
+			"cn": "color: #27aeae; font-weight: bold;",
+			"co": "color: #7a7c7d;",
+			"cv": "color: #7f8c8d;",
+			"do": "color: #a43340;",
+			"dt": "color: #2980b9;",
+			"dv": "color: #f67400;",
+			"er": "color: #da4453; text-decoration: underline;",
+			"ex": "color: #0099ff; font-weight: bold;",
+			"fl": "color: #f67400;",
+			"fu": "color: #8e44ad;",
+			"im": "color: #27ae60;",
+			"in": "color: #c45b00;",
+			"kw": "color: #cfcfc2; font-weight: bold;",
+			"op": "color: #cfcfc2;",
+			"ot": "color: #27ae60;",
+			"pp": "color: #27ae60;",
+			"sc": "color: #3daee9;",
+			"ss": "color: #da4453;",
+			"st": "color: #f44f4f;",
+			"va": "color: #27aeae;",
+			"vs": "color: #da4453;",
+			"wa": "color: #da4453;",
+		},
+	},
+}
+
+// highlightThemeNames lists the theme names in order, for error messages.
+func highlightThemeNames() []string {
+	names := make([]string, 0, len(highlightThemes))
+	for name := range highlightThemes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// highlightCSS renders theme as a style sheet for the highlighted blocks
+// html.xsl writes, a pre of class sourceCode around their code.
+func highlightCSS(theme highlightTheme) string {
+	var builder strings.Builder
+	builder.WriteString("pre.sourceCode { overflow: auto;")
+	if theme.Background != "" {
+		fmt.Fprintf(&builder, " background-color: %s;", theme.Background)
+	}
+	if theme.Color != "" {
+		fmt.Fprintf(&builder, " color: %s;", theme.Color)
+	}
+	builder.WriteString(" }\n")
+
+	classes := make([]string, 0, len(theme.Tokens))
+	for class := range theme.Tokens {
+		classes = append(classes, class)
+	}
+	slices.Sort(classes)
+	for _, class := range classes {
+		fmt.Fprintf(&builder, "pre.sourceCode span.%s { %s }\n", class, theme.Tokens[class])
+	}
+	return builder.String()
+}
+
+// buildHighlightCSS writes highlight.css next to the generated XML, so that
+// it is copied into the output of every stylesheet. Nothing is written
+// unless highlightTheme names a theme.
+func buildHighlightCSS(config *Config, outputPath string) error {
+	if config.HighlightTheme == "" {
+		return nil
+	}
+
+	css := highlightCSS(highlightThemes[config.HighlightTheme])
+	if err := writeOutput(filepath.Join(outputPath, highlightFileName), []byte(css), config); err != nil {
+		return fmt.Errorf("failed to write %s: %w", highlightFileName, err)
+	}
+	return nil
+}
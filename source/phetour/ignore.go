@@ -0,0 +1,98 @@
+package phetour
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	ignoreFilePath = "./.phetourignore"
+)
+
+// IgnoreList holds the patterns of the ignore file. Patterns are matched
+// against slash-separated paths relative to an input root, posts or
+// statics. A pattern without a slash matches a file or directory of that
+// name at any depth; one with a slash matches from the root, with "**"
+// standing for any number of directories. A trailing slash restricts a
+// pattern to directories.
+type IgnoreList struct {
+	patterns []string
+}
+
+// LoadIgnore reads the ignore file. A missing file ignores nothing.
+func LoadIgnore() (*IgnoreList, error) {
+	ignore := &IgnoreList{}
+
+	content, err := os.ReadFile(ignoreFilePath)
+	if os.IsNotExist(err) {
+		return ignore, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading ignore file: %w", err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		pattern := strings.TrimSpace(line)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s' in ignore file: %w", pattern, err)
+		}
+		ignore.patterns = append(ignore.patterns, pattern)
+	}
+
+	return ignore, nil
+}
+
+// Matches reports whether the file or directory at relPath is ignored. A
+// nil list, as in a Config not made by LoadConfig, ignores nothing.
+func (ignore *IgnoreList) Matches(relPath string, isDir bool) bool {
+	if ignore == nil {
+		return false
+	}
+	segments := strings.Split(relPath, "/")
+	for _, pattern := range ignore.patterns {
+		pattern, dirOnly := strings.CutSuffix(pattern, "/")
+		if dirOnly && !isDir {
+			continue
+		}
+
+		if !strings.Contains(pattern, "/") {
+			if matched, _ := path.Match(pattern, segments[len(segments)-1]); matched {
+				return true
+			}
+			continue
+		}
+
+		if matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for skip := 0; skip <= len(segments); skip++ {
+			if matchSegments(pattern[1:], segments[skip:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
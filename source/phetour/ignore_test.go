@@ -0,0 +1,10 @@
+package phetour
+
+import "testing"
+
+func TestNilIgnoreListMatchesNothing(t *testing.T) {
+	var ignore *IgnoreList
+	if ignore.Matches("drafts/bees.md", false) {
+		t.Error("nil ignore list matches a file")
+	}
+}
@@ -0,0 +1,65 @@
+package phetour
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// normalizeDocument reads a post written as XML into the canonical
+// document/meta/body tree. Besides that form it accepts the older, looser
+// ones: a bare meta followed by content with no document around them,
+// content elements next to the body instead of inside it, and stray text,
+// which becomes a text block. It works on the parsed tree, so neither the
+// layout of the file nor markup inside the content can confuse it.
+func normalizeDocument(content string) (*etree.Document, error) {
+	source := etree.NewDocument()
+	if err := source.ReadFromString(content); err != nil {
+		return nil, fmt.Errorf("failed to parse as XML: %w", err)
+	}
+
+	top := source.Child
+	if root := source.Root(); root != nil && root.Tag == "document" && len(source.ChildElements()) == 1 {
+		top = root.Child
+	}
+
+	doc := etree.NewDocument()
+	docRoot := doc.CreateElement("document")
+	meta := docRoot.CreateElement("meta")
+	body := docRoot.CreateElement("body")
+
+	for _, token := range top {
+		switch token := token.(type) {
+		case *etree.Element:
+			switch token.Tag {
+			case "meta":
+				moveChildren(token, meta)
+			case "body":
+				moveChildren(token, body)
+			default:
+				copyElement(token, body)
+			}
+		case *etree.CharData:
+			if text := strings.TrimSpace(token.Data); text != "" {
+				body.CreateElement("text").CreateText(text)
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+// moveChildren copies the elements and text of src into dst.
+func moveChildren(src, dst *etree.Element) {
+	for _, token := range src.Child {
+		switch token := token.(type) {
+		case *etree.Element:
+			copyElement(token, dst)
+		case *etree.CharData:
+			if strings.TrimSpace(token.Data) != "" {
+				dst.CreateText(token.Data)
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package phetour
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// externalLinkTimeout bounds how long checking one external link may take.
+const externalLinkTimeout = 10 * time.Second
+
+// checkLinks reports the links of post bodies that lead nowhere. Links
+// within the site, starting with a single /, are looked up in the
+// generated XML directory, statics included, so it must be complete by
+// then. Links to other sites are requested only with checkExternalLinks.
+func checkLinks(source *Source, xmlOutputPath string, config *Config) []string {
+	var warnings []string
+	client := &http.Client{Timeout: externalLinkTimeout}
+	checked := map[string]string{}
+
+	for _, post := range source.Posts {
+		body := post.Content.Root().SelectElement("body")
+		if body == nil {
+			continue
+		}
+		for _, link := range body.FindElements(".//link") {
+			href := link.SelectAttrValue("href", "")
+			switch {
+			case strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//"):
+				if !internalTargetExists(href, xmlOutputPath) {
+					warnings = append(warnings, fmt.Sprintf("post %s links to %s, which is not a page or file of the site", post.Name, href))
+				}
+			case config.CheckExternalLinks && (strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://")):
+				problem, seen := checked[href]
+				if !seen {
+					problem = checkExternalLink(client, href)
+					checked[href] = problem
+				}
+				if problem != "" {
+					warnings = append(warnings, fmt.Sprintf("post %s links to %s, which %s", post.Name, href, problem))
+				}
+			}
+		}
+	}
+
+	return warnings
+}
+
+// internalTargetExists reports whether href names a generated page, that
+// is a directory with an index.xml, or a file copied into the output.
+func internalTargetExists(href, xmlOutputPath string) bool {
+	path, _, _ := strings.Cut(href, "#")
+	path, _, _ = strings.Cut(path, "?")
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+
+	target := filepath.Join(xmlOutputPath, filepath.FromSlash(path))
+	info, err := os.Stat(target)
+	if err != nil {
+		return false
+	}
+	if info.IsDir() {
+		_, err := os.Stat(filepath.Join(target, "index.xml"))
+		return err == nil
+	}
+	return !strings.HasSuffix(path, "/")
+}
+
+// checkExternalLink requests href and describes what is wrong with the
+// answer, or returns "" when there is nothing wrong. Servers refusing HEAD
+// requests are asked again with GET.
+func checkExternalLink(client *http.Client, href string) string {
+	response, err := client.Head(href)
+	if err == nil && (response.StatusCode == http.StatusMethodNotAllowed || response.StatusCode == http.StatusNotImplemented) {
+		response.Body.Close()
+		response, err = client.Get(href)
+	}
+	if err != nil {
+		return fmt.Sprintf("could not be reached: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode >= 400 {
+		return "answers " + response.Status
+	}
+	return ""
+}
@@ -0,0 +1,166 @@
+package phetour
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	defaultLockFile = "./lock.xml"
+)
+
+type Key struct {
+	ID    int    `json:"id"`
+	Value string `json:"value"`
+}
+
+type Keylock struct {
+	Keys []Key
+}
+
+// jsonLock is the layout of a lock file kept as JSON.
+type jsonLock struct {
+	Keys []Key `json:"keys"`
+}
+
+// isJSONLock reports whether the lock file at path is kept as JSON, which
+// its extension tells; any other lock file is XML.
+func isJSONLock(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// LoadKeylock reads the lock file named by lockFile, as JSON or XML after
+// its extension. While a lockFile set to another name does not exist yet,
+// the keys are read from lock.xml, so that switching formats keeps every
+// ID; the next save writes them to the new file. A missing file gives an
+// empty keylock.
+func LoadKeylock(config *Config) (*Keylock, error) {
+	keylock := &Keylock{Keys: []Key{}}
+
+	path := config.LockFile
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		path = defaultLockFile
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return keylock, nil
+	}
+
+	if isJSONLock(path) {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed reading lock file: %w", err)
+		}
+		var lock jsonLock
+		if err := json.Unmarshal(content, &lock); err != nil {
+			return nil, fmt.Errorf("failed reading lock file %s: %w", path, err)
+		}
+		keylock.Keys = append(keylock.Keys, lock.Keys...)
+		return keylock, checkKeylock(keylock, path)
+	}
+
+	lockDocument := etree.NewDocument()
+	if err := lockDocument.ReadFromFile(path); err != nil {
+		return nil, fmt.Errorf("failed reading lock file: %w", err)
+	}
+
+	lock := lockDocument.SelectElement("lock")
+	for _, keyElement := range lock.SelectElements("key") {
+		keyIDstring := keyElement.SelectAttrValue("id", "")
+		keyValue := keyElement.SelectAttrValue("value", "")
+
+		keyID, err := strconv.Atoi(keyIDstring)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id '%s' in lock file: %w", keyIDstring, err)
+		}
+
+		keylock.Keys = append(keylock.Keys, Key{ID: keyID, Value: keyValue})
+	}
+
+	return keylock, checkKeylock(keylock, path)
+}
+
+// checkKeylock reports every ID and every value the lock file at path holds
+// more than once, which a badly resolved merge conflict leaves behind.
+// Either would give a post, tag or author two URLs or two of them one, so
+// the build stops until the file is mended.
+func checkKeylock(keylock *Keylock, path string) error {
+	var errs []error
+	ids := map[int]string{}
+	values := map[string]int{}
+	for _, key := range keylock.Keys {
+		if other, ok := ids[key.ID]; ok {
+			errs = append(errs, fmt.Errorf("id %d is given to both %s and %s", key.ID, other, key.Value))
+		} else {
+			ids[key.ID] = key.Value
+		}
+		if other, ok := values[key.Value]; ok {
+			errs = append(errs, fmt.Errorf("%s has both id %d and id %d", key.Value, other, key.ID))
+		} else {
+			values[key.Value] = key.ID
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid lock file %s: %w", path, errors.Join(errs...))
+	}
+	return nil
+}
+
+func (keylock *Keylock) Save(config *Config) error {
+	if isJSONLock(config.LockFile) {
+		return keylock.saveJSON(config)
+	}
+
+	lockDocument := etree.NewDocument()
+	lockTag := lockDocument.CreateElement("lock")
+
+	for _, key := range keylock.Keys {
+		keyElement := lockTag.CreateElement("key")
+		keyElement.CreateAttr("id", strconv.Itoa(key.ID))
+		keyElement.CreateAttr("value", key.Value)
+	}
+
+	indentDocument(lockDocument, config)
+	return lockDocument.WriteToFile(config.LockFile)
+}
+
+// saveJSON writes the lock as JSON, indented like the XML files.
+func (keylock *Keylock) saveJSON(config *Config) error {
+	var data []byte
+	var err error
+	switch config.Indent {
+	case IndentNone:
+		data, err = json.Marshal(jsonLock{Keys: keylock.Keys})
+	case IndentTabs:
+		data, err = json.MarshalIndent(jsonLock{Keys: keylock.Keys}, "", "\t")
+	default:
+		data, err = json.MarshalIndent(jsonLock{Keys: keylock.Keys}, "", strings.Repeat(" ", config.Indent))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode lock file: %w", err)
+	}
+	return os.WriteFile(config.LockFile, append(data, '\n'), config.FileMode)
+}
+
+// AssureKey returns the ID of value, giving it the next ID after the
+// highest one when it has none, so that a lock with gaps, edited by hand,
+// never hands out an ID twice.
+func (keylock *Keylock) AssureKey(value string) int {
+	highest := 0
+	for _, key := range keylock.Keys {
+		if key.Value == value {
+			return key.ID
+		}
+		highest = max(highest, key.ID)
+	}
+
+	newID := highest + 1
+	keylock.Keys = append(keylock.Keys, Key{ID: newID, Value: value})
+	return newID
+}
@@ -0,0 +1,17 @@
+package phetour
+
+import "testing"
+
+func TestAssureKeyAfterGap(t *testing.T) {
+	keylock := &Keylock{Keys: []Key{{ID: 1, Value: "POST:a.md"}, {ID: 3, Value: "POST:c.md"}}}
+
+	if id := keylock.AssureKey("POST:c.md"); id != 3 {
+		t.Errorf("existing key got ID %d, want 3", id)
+	}
+	if id := keylock.AssureKey("POST:d.md"); id != 4 {
+		t.Errorf("new key got ID %d, want 4", id)
+	}
+	if err := checkKeylock(keylock, "lock.xml"); err != nil {
+		t.Errorf("lock after adding a key: %v", err)
+	}
+}
@@ -0,0 +1,350 @@
+package phetour
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	manifestFileName = "manifest.xml"
+)
+
+// Manifest records every file a build wrote into the output directory, so
+// that the next build removes only what phetour itself created, can tell
+// which pages are unchanged, and so that deploys can upload only the files
+// whose hash changed. Keys records how keys were rendered, so that a change
+// of every URL does not go unnoticed, and Sources fingerprints the input
+// the XML was built from, so that build -styles can tell it still holds.
+// Scheduled is when the first post left out for its date is due, after
+// which that XML no longer holds either. Params maps each stylesheet to
+// the hash of the parameters it was applied with, since a page is only as
+// current as they are.
+type Manifest struct {
+	Keys      string
+	Sources   string
+	Scheduled time.Time
+	Params    map[string]string
+	Files     []ManifestFile
+}
+
+// ManifestFile is one file of the output. Static marks the copies of
+// statics in the XML directory, which the next build may leave in place.
+type ManifestFile struct {
+	Path   string
+	Hash   string
+	Static bool
+}
+
+// LoadManifest reads the manifest of the previous build. It returns nil
+// when there is none.
+func LoadManifest(outputPath string) (*Manifest, error) {
+	manifestPath := filepath.Join(outputPath, manifestFileName)
+	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	manifestDocument := etree.NewDocument()
+	if err := manifestDocument.ReadFromFile(manifestPath); err != nil {
+		return nil, fmt.Errorf("failed reading manifest: %w", err)
+	}
+
+	root := manifestDocument.SelectElement("manifest")
+	if root == nil {
+		return nil, fmt.Errorf("no manifest element found in %s", manifestPath)
+	}
+
+	manifest := &Manifest{
+		Keys:    root.SelectAttrValue("keys", ""),
+		Sources: root.SelectAttrValue("sources", ""),
+	}
+	if value := root.SelectAttrValue("scheduled", ""); value != "" {
+		scheduled, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scheduled time '%s' in %s: %w", value, manifestPath, err)
+		}
+		manifest.Scheduled = scheduled
+	}
+	for _, styleElement := range root.SelectElements("style") {
+		if manifest.Params == nil {
+			manifest.Params = map[string]string{}
+		}
+		manifest.Params[styleElement.SelectAttrValue("name", "")] = styleElement.SelectAttrValue("params", "")
+	}
+	for _, fileElement := range root.SelectElements("file") {
+		path := fileElement.SelectAttrValue("path", "")
+		if !filepath.IsLocal(filepath.FromSlash(path)) {
+			return nil, fmt.Errorf("refusing manifest entry '%s' in %s: not inside the output directory", path, manifestPath)
+		}
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Path:   path,
+			Hash:   fileElement.SelectAttrValue("hash", ""),
+			Static: fileElement.SelectAttrValue("static", "") == "true",
+		})
+	}
+
+	return manifest, nil
+}
+
+// NewManifest hashes every file under the given directories of outputPath,
+// except the ones in foreign, which were there before the build started.
+// Statics holds the paths of the static copies.
+func NewManifest(outputPath string, directories []string, foreign map[string]bool, statics map[string]bool) (*Manifest, error) {
+	manifest := &Manifest{}
+	err := walkOutput(outputPath, directories, func(relPath string) error {
+		if foreign[relPath] {
+			return nil
+		}
+
+		hash, err := hashFile(filepath.Join(outputPath, filepath.FromSlash(relPath)))
+		if err != nil {
+			return err
+		}
+
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Path:   relPath,
+			Hash:   hash,
+			Static: statics[filepath.Join(outputPath, filepath.FromSlash(relPath))],
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// foreignFiles lists the files under the given directories of outputPath
+// that the previous build did not write. Phetour did not create them, so
+// they are left out of the manifest and survive the next build.
+func foreignFiles(outputPath string, directories []string, previous map[string]string) (map[string]bool, error) {
+	foreign := map[string]bool{}
+	err := walkOutput(outputPath, directories, func(relPath string) error {
+		if _, owned := previous[relPath]; !owned {
+			foreign[relPath] = true
+		}
+		return nil
+	})
+	return foreign, err
+}
+
+// walkOutput calls fn with the slash-separated path, relative to outputPath,
+// of every file under the given directories of outputPath. The directory
+// "." stands for the files of the primary style in the output root.
+func walkOutput(outputPath string, directories []string, fn func(relPath string) error) error {
+	for _, directory := range directories {
+		err := filepath.WalkDir(filepath.Join(outputPath, directory), func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// The output root holds the primary style's pages next to the
+			// other directories, which are walked on their own.
+			if directory == "." && filepath.Dir(path) == filepath.Clean(outputPath) &&
+				(slices.Contains(directories, entry.Name()) || entry.Name() == manifestFileName) {
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				return nil
+			}
+
+			relPath, err := filepath.Rel(outputPath, path)
+			if err != nil {
+				return err
+			}
+			return fn(filepath.ToSlash(relPath))
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to list output files: %w", err)
+		}
+	}
+	return nil
+}
+
+func (manifest *Manifest) Save(config *Config) error {
+	doc := etree.NewDocument()
+	root := doc.CreateElement("manifest")
+	if manifest.Keys != "" {
+		root.CreateAttr("keys", manifest.Keys)
+	}
+	if manifest.Sources != "" {
+		root.CreateAttr("sources", manifest.Sources)
+	}
+	if !manifest.Scheduled.IsZero() {
+		root.CreateAttr("scheduled", manifest.Scheduled.Format(time.RFC3339))
+	}
+	for _, name := range slices.Sorted(maps.Keys(manifest.Params)) {
+		styleElement := root.CreateElement("style")
+		styleElement.CreateAttr("name", name)
+		styleElement.CreateAttr("params", manifest.Params[name])
+	}
+	for _, file := range manifest.Files {
+		fileElement := root.CreateElement("file")
+		fileElement.CreateAttr("path", file.Path)
+		fileElement.CreateAttr("hash", file.Hash)
+		if file.Static {
+			fileElement.CreateAttr("static", "true")
+		}
+	}
+
+	if err := writeDocument(doc, filepath.Join(config.OutputPath, manifestFileName), config); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Hashes maps the path of every file in the manifest to its hash. A nil
+// manifest has none.
+func (manifest *Manifest) Hashes() map[string]string {
+	hashes := map[string]string{}
+	if manifest != nil {
+		for _, file := range manifest.Files {
+			hashes[file.Path] = file.Hash
+		}
+	}
+	return hashes
+}
+
+// StyleParams returns the parameter hashes of the manifest by stylesheet,
+// an empty map for a nil manifest.
+func (manifest *Manifest) StyleParams() map[string]string {
+	if manifest == nil || manifest.Params == nil {
+		return map[string]string{}
+	}
+	return manifest.Params
+}
+
+// adoptedManifest stands in for the manifest of a build that left none,
+// such as one made before manifests were kept. The XML directory and the
+// directory of every stylesheet are the ones phetour writes, so their files
+// are taken as its own, but with no hash, so that no page is kept as up to
+// date and whatever this build does not produce again is removed. Files in
+// the output root are left alone, since nothing tells them apart from
+// files phetour did not write.
+func adoptedManifest(outputPath string, styleDirectories []string) (*Manifest, error) {
+	directories := append([]string{"xml"}, styleDirectories...)
+	for _, name := range directories {
+		path := filepath.Join(outputPath, name)
+		info, err := os.Lstat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s: %w", path, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("refusing to build into %s: not a directory", path)
+		}
+	}
+
+	manifest := &Manifest{}
+	err := walkOutput(outputPath, directories, func(relPath string) error {
+		manifest.Files = append(manifest.Files, ManifestFile{Path: relPath})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// savePartialManifest records the files a failed build wrote so far, so
+// that the next build still knows them as its own and removes those it no
+// longer produces. It carries no fingerprint and no parameter hashes, so
+// that the next build neither reuses the XML nor keeps a single page.
+func savePartialManifest(directories []string, foreign map[string]bool, statics map[string]bool, config *Config) error {
+	manifest, err := NewManifest(config.OutputPath, directories, foreign, statics)
+	if err != nil {
+		return err
+	}
+	return manifest.Save(config)
+}
+
+// stalePaths lists what is removed from outputPath before a build: the
+// intermediate XML of the previous manifest but for the kept static copies.
+// Stylesheet output listed in a manifest stays, so that pages whose input
+// did not change need not be transformed again.
+func stalePaths(outputPath string, manifest *Manifest, kept map[string]string) []string {
+	var stale []string
+	for _, file := range manifest.Files {
+		if !strings.HasPrefix(file.Path, "xml/") {
+			continue
+		}
+		path := filepath.Join(outputPath, filepath.FromSlash(file.Path))
+		if _, isKept := kept[path]; isKept {
+			continue
+		}
+		if _, err := os.Lstat(path); err == nil {
+			stale = append(stale, path)
+		}
+	}
+	return stale
+}
+
+// leftoverPaths lists the stylesheet output of the previous manifest that
+// this build did not produce again, such as the pages of a deleted post.
+func leftoverPaths(outputPath string, manifest *Manifest, produced map[string]bool) []string {
+	var leftover []string
+	if manifest == nil {
+		return nil
+	}
+	for _, file := range manifest.Files {
+		if strings.HasPrefix(file.Path, "xml/") || produced[file.Path] {
+			continue
+		}
+		path := filepath.Join(outputPath, filepath.FromSlash(file.Path))
+		if _, err := os.Lstat(path); err == nil {
+			leftover = append(leftover, path)
+		}
+	}
+	return leftover
+}
+
+// removeStale removes the stale paths, then every directory under
+// outputPath that was left empty by it.
+func removeStale(outputPath string, stale []string) error {
+	for _, path := range stale {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+
+		for dir := filepath.Dir(path); dir != filepath.Clean(outputPath); dir = filepath.Dir(dir) {
+			entries, err := os.ReadDir(dir)
+			if err != nil || len(entries) > 0 {
+				break
+			}
+			if err := os.Remove(dir); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", dir, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package phetour
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAdoptedManifest(t *testing.T) {
+	outputPath := t.TempDir()
+	for _, path := range []string{"xml/0x0001/index.xml", "html/0x0001/index.html", "notes.txt"} {
+		path = filepath.Join(outputPath, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest, err := adoptedManifest(outputPath, []string{"html", "gmi"})
+	if err != nil {
+		t.Fatalf("adoptedManifest: %v", err)
+	}
+	var paths []string
+	for _, file := range manifest.Files {
+		if file.Hash != "" {
+			t.Errorf("adopted file %s has hash %q, want none", file.Path, file.Hash)
+		}
+		paths = append(paths, file.Path)
+	}
+	if want := []string{"xml/0x0001/index.xml", "html/0x0001/index.html"}; !slices.Equal(paths, want) {
+		t.Errorf("adopted files are %q, want %q", paths, want)
+	}
+
+	stale := stalePaths(outputPath, manifest, nil)
+	if len(stale) != 1 || stale[0] != filepath.Join(outputPath, "xml", "0x0001", "index.xml") {
+		t.Errorf("stale paths are %q, want the adopted XML", stale)
+	}
+
+	_, err = adoptedManifest(outputPath, []string{"notes.txt"})
+	if err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("error is %v, want a refusal to build into a file", err)
+	}
+}
@@ -0,0 +1,71 @@
+package phetour
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Draft describes a post to be scaffolded by NewPost.
+type Draft struct {
+	Title string
+	Tags  []string
+	Date  string
+	Draft bool
+}
+
+// NewPost writes a post file with draft's header filled in, named after the
+// slug of its title, into the first of the posts folders and returns its
+// path. An existing file is never overwritten.
+func NewPost(draft Draft, config *Config) (string, error) {
+	title := strings.TrimSpace(draft.Title)
+	if title == "" {
+		return "", fmt.Errorf("title must not be empty")
+	}
+	name := slugify(title)
+	if name == "" {
+		return "", fmt.Errorf("title '%s' has no letters or digits to name the file after", title)
+	}
+
+	// Header fields end at the line break, so a value spanning lines would
+	// leak into the content.
+	for _, value := range append([]string{title, draft.Date}, draft.Tags...) {
+		if strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("'%s' must fit on one line", value)
+		}
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# %s\n\n", title)
+	for _, tag := range draft.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			fmt.Fprintf(&builder, "> %s\n", tag)
+		}
+	}
+	if draft.Date != "" {
+		if _, err := parseDate(draft.Date); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&builder, "date: %s\n", draft.Date)
+	}
+	if draft.Draft {
+		builder.WriteString("draft: true\n")
+	}
+	builder.WriteString("\n")
+
+	postsDir := config.PostsPaths[0]
+	path := filepath.Join(postsDir, name+".md")
+	if err := os.MkdirAll(postsDir, defaultDirMode); err != nil {
+		return "", fmt.Errorf("failed to create posts folder: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, defaultFileMode)
+	if err != nil {
+		return "", fmt.Errorf("failed to create post: %w", err)
+	}
+	if _, err := file.WriteString(builder.String()); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write post: %w", err)
+	}
+	return path, file.Close()
+}
@@ -0,0 +1,79 @@
+package phetour
+
+import (
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// addMarkdownTextBlock adds the paragraph of lines, as written, to body as
+// a text element with its inline Markdown rendered by converter: emphasis,
+// strong, code, link and break elements among the text. Footnote
+// references are escaped on the way in, so they come back as text for
+// addInlineText. It reports false, adding nothing, when the converter fails
+// or reads the lines as anything but a single paragraph, like a setext
+// heading; the paragraph is then raw text as usual.
+func addMarkdownTextBlock(body *etree.Element, lines []string, converter Converter) bool {
+	markdown := footnoteReferencePattern.ReplaceAllString(strings.Join(lines, "\n"), `\[\^$1]`)
+	fragment, err := converter.Convert(markdown)
+	if err != nil {
+		return false
+	}
+
+	blocks := fragment.Root().ChildElements()
+	if len(blocks) != 1 || blocks[0].Tag != "p" {
+		return false
+	}
+
+	text := body.CreateElement("text")
+	addMarkdownInlines(text, blocks[0])
+	return true
+}
+
+// markdownPunctuation are the characters a backslash escapes in Markdown.
+const markdownPunctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// markdownLine drops a backslash escaping the first character of line where
+// Markdown would keep it, before a letter for one, and escapes a lone
+// backslash, which Markdown would take for a hard break, so that a line
+// means the same to the converter as it does to addTextBlock.
+func markdownLine(line string) string {
+	if line == "\\" {
+		return "\\\\"
+	}
+	if len(line) >= 2 && line[0] == '\\' && !strings.ContainsRune(markdownPunctuation, rune(line[1])) {
+		return line[1:]
+	}
+	return line
+}
+
+// addMarkdownInlines adds the content of the HTML element source to target,
+// turning em, strong, code, a and br into their elements of the page
+// schema. Any other element is reduced to its content, and an image to
+// nothing.
+func addMarkdownInlines(target *etree.Element, source *etree.Element) {
+	for _, child := range source.Child {
+		switch child := child.(type) {
+		case *etree.CharData:
+			addInlineText(target, child.Data)
+		case *etree.Element:
+			switch child.Tag {
+			case "em":
+				addMarkdownInlines(target.CreateElement("emphasis"), child)
+			case "strong":
+				addMarkdownInlines(target.CreateElement("strong"), child)
+			case "code":
+				target.CreateElement("code").CreateText(child.Text())
+			case "a":
+				link := target.CreateElement("link")
+				link.CreateAttr("href", child.SelectAttrValue("href", ""))
+				link.CreateText(strings.Join(strings.Fields(innerText(child)), " "))
+			case "br":
+				target.CreateElement("break")
+			case "img":
+			default:
+				addMarkdownInlines(target, child)
+			}
+		}
+	}
+}
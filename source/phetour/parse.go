@@ -0,0 +1,627 @@
+package phetour
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	partialsPath     = "./input/partials"
+	includeDirective = "@include "
+)
+
+// ParseError points at the line of a post file that could not be parsed.
+type ParseError struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Message)
+}
+
+// normalizeText strips a leading UTF-8 byte order mark and turns CRLF and
+// lone CR line endings into LF, so that files saved by Windows editors
+// split into the same lines as any other.
+func normalizeText(content string) string {
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	return strings.ReplaceAll(content, "\r", "\n")
+}
+
+// parseDocument parses a post written in the custom syntax. It keeps going
+// after a malformed header line, so that every problem of the header is
+// reported at once, joined into a single error with the first problem of
+// the body, where parsing stops.
+func parseDocument(content string, filePath string, converter Converter, paragraphs Converter) (*etree.Document, error) {
+	lines := strings.Split(content, "\n")
+
+	var title headerField
+	var tags []string
+	var fields []headerField
+	var errs []error
+
+	titleLine := -1
+	for i, line := range lines {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "#") {
+			title = headerField{Name: "title", Value: strings.TrimSpace(strings.TrimPrefix(trimmed, "#")), Line: i + 1}
+			titleLine = i
+			break
+		}
+	}
+
+	if titleLine < 0 {
+		return nil, &ParseError{Path: filePath, Message: "no title found: expected a line starting with '#'"}
+	}
+	if title.Value == "" {
+		errs = append(errs, &ParseError{Path: filePath, Line: titleLine + 1, Message: "empty title"})
+	}
+
+	i := titleLine + 1
+	for i < len(lines) {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			i++
+			continue
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			// A bare > stands for tags yet to be decided.
+			if label := strings.TrimSpace(strings.TrimPrefix(trimmed, ">")); label != "" {
+				tags = append(tags, label)
+			}
+			i++
+		} else if name, value, ok := parseHeaderField(trimmed); ok {
+			if value == "" {
+				errs = append(errs, &ParseError{Path: filePath, Line: i + 1, Message: fmt.Sprintf("empty value for %s", name)})
+			} else {
+				fields = append(fields, headerField{Name: name, Value: value, Line: i + 1})
+			}
+			i++
+		} else {
+			break
+		}
+	}
+
+	doc, body := newPostDocument(title, tags, fields)
+	if err := parseContent(lines, i, body, filePath, converter, paragraphs); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return doc, nil
+}
+
+// headerField is the title or a field of a post header, with the line it
+// was written on, 0 when there is none.
+type headerField struct {
+	Name  string
+	Value string
+	Line  int
+}
+
+// newPostDocument starts the document of a post with its meta, whichever
+// way the header was written, and returns it with its still empty body.
+// The title and every field keep their line in a line attribute, so that
+// a value rejected when the meta is read can be pointed at.
+func newPostDocument(title headerField, tags []string, fields []headerField) (*etree.Document, *etree.Element) {
+	doc := etree.NewDocument()
+	docRoot := doc.CreateElement("document")
+
+	meta := docRoot.CreateElement("meta")
+	addHeaderField(meta, title)
+	for _, label := range tags {
+		meta.CreateElement("tag").CreateAttr("label", label)
+	}
+	for _, field := range fields {
+		addHeaderField(meta, field)
+	}
+
+	return doc, docRoot.CreateElement("body")
+}
+
+func addHeaderField(meta *etree.Element, field headerField) {
+	elem := meta.CreateElement(field.Name)
+	elem.CreateAttr("value", field.Value)
+	if field.Line > 0 {
+		elem.CreateAttr("line", strconv.Itoa(field.Line))
+	}
+}
+
+// headerFields lists the names accepted as "name: value" lines in a post
+// header. Any other line ends the header, so prose that happens to contain
+// a colon is never mistaken for metadata.
+var headerFields = []string{"summary", "author", "slug", "image", "date", "updated", "draft", "unlisted", "bareLayout", "style", "section", "series", "seriesOrder"}
+
+func parseHeaderField(line string) (string, string, bool) {
+	name, value, found := strings.Cut(line, ":")
+	if !found || !slices.Contains(headerFields, name) {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(value), true
+}
+
+// parseContent parses the body of a post from line start on, partials
+// included, and numbers its footnotes. Paragraphs go through paragraphs
+// when it is not nil, and are kept as raw text otherwise.
+func parseContent(lines []string, start int, body *etree.Element, filePath string, converter Converter, paragraphs Converter) error {
+	footnotes, err := parseBlocks(lines, start, body, filePath, converter, paragraphs, []string{filePath})
+	if err != nil {
+		return err
+	}
+	addFootnotes(body, footnotes)
+	return nil
+}
+
+// parseBlocks adds the content blocks of lines to body and returns the
+// footnotes defined along the way. including lists the files being parsed,
+// the outermost first, so that a partial including itself is caught.
+func parseBlocks(lines []string, start int, body *etree.Element, filePath string, converter Converter, paragraphs Converter, including []string) ([][2]string, error) {
+	var footnotes [][2]string
+	i := start
+	for i < len(lines) {
+		trimmed := strings.TrimSpace(lines[i])
+
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			codeBlock, nextIdx, err := parseCodeBlock(lines, i, filePath, converter)
+			if err != nil {
+				return nil, err
+			}
+			if codeBlock != nil {
+				body.AddChild(codeBlock)
+			}
+			i = nextIdx
+
+		case trimmed == "{{{":
+			htmlBlock, nextIdx, err := parseHTMLBlock(lines, i, filePath)
+			if err != nil {
+				return nil, err
+			}
+			body.AddChild(htmlBlock)
+			i = nextIdx
+
+		case strings.HasPrefix(trimmed, includeDirective):
+			name := strings.TrimSpace(strings.TrimPrefix(trimmed, includeDirective))
+			partialFootnotes, err := parsePartial(name, body, filePath, i+1, converter, paragraphs, including)
+			if err != nil {
+				return nil, err
+			}
+			for _, footnote := range partialFootnotes {
+				if slices.ContainsFunc(footnotes, func(other [2]string) bool { return other[0] == footnote[0] }) {
+					return nil, &ParseError{Path: filePath, Line: i + 1, Message: fmt.Sprintf("footnote [^%s] of partial %s is defined twice", footnote[0], name)}
+				}
+			}
+			footnotes = append(footnotes, partialFootnotes...)
+			i++
+
+		case isTableStart(lines, i):
+			table, nextIdx := parseTable(lines, i)
+			body.AddChild(table)
+			i = nextIdx
+
+		case strings.HasPrefix(trimmed, "# "):
+			body.CreateElement("bold").CreateText(strings.TrimPrefix(trimmed, "# "))
+			i++
+
+		case strings.HasPrefix(trimmed, "- "):
+			addInlineText(body.CreateElement("item"), strings.TrimPrefix(trimmed, "- "))
+			i++
+
+		case footnoteDefinitionPattern.MatchString(trimmed):
+			match := footnoteDefinitionPattern.FindStringSubmatch(trimmed)
+			if match[2] == "" {
+				return nil, &ParseError{Path: filePath, Line: i + 1, Message: fmt.Sprintf("empty footnote [^%s]", match[1])}
+			}
+			if slices.ContainsFunc(footnotes, func(footnote [2]string) bool { return footnote[0] == match[1] }) {
+				return nil, &ParseError{Path: filePath, Line: i + 1, Message: fmt.Sprintf("footnote [^%s] is defined twice", match[1])}
+			}
+			footnotes = append(footnotes, [2]string{match[1], match[2]})
+			i++
+
+		case strings.HasPrefix(trimmed, "> "):
+			linkContent := strings.TrimPrefix(trimmed, "> ")
+			parts := strings.Fields(linkContent)
+			if len(parts) >= 1 {
+				link := body.CreateElement("link")
+				link.CreateAttr("href", parts[0])
+				if len(parts) > 1 {
+					link.CreateText(strings.Join(parts[1:], " "))
+				} else {
+					link.CreateText(parts[0])
+				}
+			}
+			i++
+
+		case trimmed != "":
+			rawLines := []string{markdownLine(trimmed)}
+			textLines := []string{unescapeLine(trimmed)}
+			i++
+			for i < len(lines) {
+				next := strings.TrimSpace(lines[i])
+				if next == "" ||
+					strings.HasPrefix(next, "# ") ||
+					strings.HasPrefix(next, "- ") ||
+					strings.HasPrefix(next, "> ") ||
+					strings.HasPrefix(next, "```") ||
+					next == "{{{" ||
+					strings.HasPrefix(next, includeDirective) ||
+					footnoteDefinitionPattern.MatchString(next) ||
+					isTableStart(lines, i) {
+					break
+				}
+				rawLines = append(rawLines, markdownLine(next))
+				textLines = append(textLines, unescapeLine(next))
+				i++
+			}
+			if paragraphs == nil || !addMarkdownTextBlock(body, rawLines, paragraphs) {
+				addTextBlock(body, textLines)
+			}
+
+		default:
+			i++
+		}
+	}
+
+	return footnotes, nil
+}
+
+// parsePartial splices the partial called name into body, parsed like the
+// rest of the post. filePath and line locate the include directive.
+func parsePartial(name string, body *etree.Element, filePath string, line int, converter Converter, paragraphs Converter, including []string) ([][2]string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, &ParseError{Path: filePath, Line: line, Message: fmt.Sprintf("invalid partial name '%s': name a file in %s", name, partialsPath)}
+	}
+	partialPath := filepath.Join(partialsPath, name)
+	if slices.Contains(including, partialPath) {
+		cycle := strings.Join(append(including[slices.Index(including, partialPath):], partialPath), " -> ")
+		return nil, &ParseError{Path: filePath, Line: line, Message: fmt.Sprintf("partial %s includes itself: %s", name, cycle)}
+	}
+
+	content, err := os.ReadFile(partialPath)
+	if os.IsNotExist(err) {
+		return nil, &ParseError{Path: filePath, Line: line, Message: fmt.Sprintf("partial %s not found in %s", name, partialsPath)}
+	}
+	if err != nil {
+		return nil, &ParseError{Path: filePath, Line: line, Message: fmt.Sprintf("failed to read partial %s: %v", name, err)}
+	}
+
+	lines := strings.Split(normalizeText(string(content)), "\n")
+	return parseBlocks(lines, 0, body, partialPath, converter, paragraphs, append(slices.Clone(including), partialPath))
+}
+
+// unescapeLine drops the backslash escaping the first character of line.
+// Any character may be escaped, so that a line can start with a marker, or
+// with what would read as a header field, and still be plain text.
+func unescapeLine(line string) string {
+	if len(line) >= 2 && line[0] == '\\' {
+		return line[1:]
+	}
+	return line
+}
+
+// isClosingFence reports whether line closes a code block opened with a
+// fence of the given length: backticks only, at least as many of them.
+func isClosingFence(line string, length int) bool {
+	return len(line) >= length && strings.Trim(line, "`") == ""
+}
+
+// parseCodeBlock reads the code block opened at startIdx. The opening
+// fence is three or more backticks and an optional info string; the block
+// ends at the first line holding nothing but as many backticks or more,
+// so a longer fence can enclose a shorter one.
+func parseCodeBlock(lines []string, startIdx int, filePath string, converter Converter) (*etree.Element, int, error) {
+	opening := strings.TrimSpace(lines[startIdx])
+	fence := opening[:len(opening)-len(strings.TrimLeft(opening, "`"))]
+	info := strings.TrimSpace(strings.TrimPrefix(opening, fence))
+	if strings.Contains(info, "`") {
+		return nil, startIdx, &ParseError{Path: filePath, Line: startIdx + 1, Message: "backtick in the info string of a code fence"}
+	}
+
+	endIdx := startIdx + 1
+	stray := -1
+	for endIdx < len(lines) {
+		line := strings.TrimSpace(lines[endIdx])
+		if isClosingFence(line, len(fence)) {
+			break
+		}
+		if stray < 0 && strings.HasPrefix(line, fence) {
+			stray = endIdx
+		}
+		endIdx++
+	}
+
+	if endIdx >= len(lines) {
+		// A fence with text after it is the likeliest reason a block
+		// never closes, so that is the line worth pointing at.
+		if stray >= 0 {
+			return nil, startIdx, &ParseError{Path: filePath, Line: stray + 1, Message: fmt.Sprintf("code block opened at line %d is not closed: a closing fence has nothing after its backticks", startIdx+1)}
+		}
+		return nil, startIdx, &ParseError{Path: filePath, Line: startIdx + 1, Message: "unclosed code block"}
+	}
+
+	language, attrs, err := parseFenceInfo(info)
+	if err != nil {
+		return nil, startIdx, &ParseError{Path: filePath, Line: startIdx + 1, Message: err.Error()}
+	}
+
+	code := etree.NewElement("code")
+	if language != "" {
+		code.CreateAttr("language", language)
+	}
+	for _, attr := range attrs {
+		code.CreateAttr(attr[0], attr[1])
+	}
+
+	codeContent := strings.Join(lines[startIdx+1:endIdx], "\n")
+
+	// Raw blocks, marked ```raw or ```{=html}, keep their content verbatim
+	// even where pandoc would have accepted it.
+	if language == "raw" || code.SelectAttr("format") != nil {
+		addCodeText(code, codeContent)
+		return code, endIdx + 1, nil
+	}
+
+	// Pandoc reads a plain block as Markdown, which is how tables get in.
+	// A block with attributes is handed over fenced, info string and all,
+	// since pandoc understands the attribute syntax itself.
+	pandocInput := codeContent
+	if len(attrs) > 0 {
+		pandocInput = fence + info + "\n" + codeContent + "\n" + fence
+	}
+
+	htmlContent, err := converter.Convert(pandocInput)
+	if err != nil {
+		addCodeText(code, codeContent)
+		return code, endIdx + 1, nil
+	}
+
+	for _, child := range htmlContent.Root().Child {
+		switch child := child.(type) {
+		case *etree.Element:
+			copyElement(child, code)
+		case *etree.CharData:
+			code.CreateText(child.Data)
+		}
+	}
+	return code, endIdx + 1, nil
+}
+
+// addCodeText adds code verbatim. It goes in a CDATA section, so that
+// samples full of <, > and & stay readable in the intermediate XML, unless
+// the code itself would end the section early.
+func addCodeText(code *etree.Element, content string) {
+	if strings.Contains(content, "]]>") {
+		code.CreateText(content)
+	} else {
+		code.CreateCData(content)
+	}
+}
+
+var (
+	footnoteReferencePattern  = regexp.MustCompile(`\[\^([^\]\s]+)\]`)
+	footnoteDefinitionPattern = regexp.MustCompile(`^\[\^([^\]\s]+)\]:\s*(.*)$`)
+)
+
+// addInlineText adds text to element, turning every [^label] in it into a
+// footnote-ref element.
+func addInlineText(element *etree.Element, text string) {
+	last := 0
+	for _, match := range footnoteReferencePattern.FindAllStringSubmatchIndex(text, -1) {
+		if match[0] > last {
+			element.CreateText(text[last:match[0]])
+		}
+		element.CreateElement("footnote-ref").CreateAttr("id", text[match[2]:match[3]])
+		last = match[1]
+	}
+	if last < len(text) || last == 0 {
+		element.CreateText(text[last:])
+	}
+}
+
+// addFootnotes numbers the footnote references of body in the order they
+// appear and appends a footnote element for each definition, referenced
+// ones first, in that order. Definitions nobody references are kept, and
+// references to nothing left as they are, for checkFootnotes to report.
+func addFootnotes(body *etree.Element, footnotes [][2]string) {
+	var order []string
+	for _, ref := range body.FindElements(".//footnote-ref") {
+		id := ref.SelectAttrValue("id", "")
+		if !slices.ContainsFunc(footnotes, func(footnote [2]string) bool { return footnote[0] == id }) {
+			continue
+		}
+		number := slices.Index(order, id) + 1
+		if number == 0 {
+			order = append(order, id)
+			number = len(order)
+		}
+		ref.CreateAttr("number", strconv.Itoa(number))
+	}
+
+	slices.SortStableFunc(footnotes, func(a, b [2]string) int {
+		return orderIndex(order, a[0]) - orderIndex(order, b[0])
+	})
+	for _, footnote := range footnotes {
+		element := body.CreateElement("footnote")
+		element.CreateAttr("id", footnote[0])
+		if number := slices.Index(order, footnote[0]) + 1; number > 0 {
+			element.CreateAttr("number", strconv.Itoa(number))
+		}
+		addInlineText(element, footnote[1])
+	}
+}
+
+// orderIndex places ids missing from order after all the others.
+func orderIndex(order []string, id string) int {
+	if i := slices.Index(order, id); i >= 0 {
+		return i
+	}
+	return len(order)
+}
+
+// checkFootnotes reports footnote references without a definition and
+// definitions without a reference.
+func checkFootnotes(body *etree.Element) []string {
+	var warnings []string
+	defined := map[string]bool{}
+	for _, footnote := range body.SelectElements("footnote") {
+		defined[footnote.SelectAttrValue("id", "")] = true
+	}
+	referenced := map[string]bool{}
+	for _, ref := range body.FindElements(".//footnote-ref") {
+		id := ref.SelectAttrValue("id", "")
+		if !defined[id] && !referenced[id] {
+			warnings = append(warnings, fmt.Sprintf("footnote [^%s] is referenced but never defined", id))
+		}
+		referenced[id] = true
+	}
+	for _, footnote := range body.SelectElements("footnote") {
+		if id := footnote.SelectAttrValue("id", ""); !referenced[id] {
+			warnings = append(warnings, fmt.Sprintf("footnote [^%s] is defined but never referenced", id))
+		}
+	}
+	return warnings
+}
+
+// addTextBlock adds a paragraph made of lines to body. A line ending in a
+// backslash is followed by a hard line break, written as a break element;
+// the other lines are wrapped by the stylesheet as it sees fit. A line of
+// a lone backslash has nothing to break and is kept as a backslash.
+func addTextBlock(body *etree.Element, lines []string) {
+	text := body.CreateElement("text")
+	var run []string
+	for n, line := range lines {
+		hard := line != "\\" && strings.HasSuffix(line, "\\")
+		if hard {
+			line = strings.TrimSpace(strings.TrimSuffix(line, "\\"))
+		}
+		run = append(run, line)
+		if hard && n < len(lines)-1 {
+			addInlineText(text, strings.Join(run, "\n"))
+			text.CreateElement("break")
+			run = nil
+		}
+	}
+	addInlineText(text, strings.Join(run, "\n"))
+}
+
+// parseHTMLBlock reads the lines between {{{ and }}} into an html element,
+// verbatim and untouched by the converter, for stylesheets to copy through.
+func parseHTMLBlock(lines []string, startIdx int, filePath string) (*etree.Element, int, error) {
+	endIdx := startIdx + 1
+	for endIdx < len(lines) && strings.TrimSpace(lines[endIdx]) != "}}}" {
+		endIdx++
+	}
+
+	if endIdx >= len(lines) {
+		return nil, startIdx, &ParseError{Path: filePath, Line: startIdx + 1, Message: "unclosed HTML block"}
+	}
+
+	html := etree.NewElement("html")
+	html.CreateCData(strings.Join(lines[startIdx+1:endIdx], "\n"))
+	return html, endIdx + 1, nil
+}
+
+// parseFenceInfo splits the info string of a code fence, as in
+// ```python {.numberLines #example startFrom="10"}, into its language and
+// attributes. Classes are joined into a single class attribute, and a raw
+// format such as {=html} becomes a format attribute.
+func parseFenceInfo(info string) (string, [][2]string, error) {
+	language, block, hasBlock := strings.Cut(info, "{")
+	if fields := strings.Fields(language); len(fields) > 0 {
+		language = fields[0]
+	} else {
+		language = ""
+	}
+	if !hasBlock {
+		return language, nil, nil
+	}
+
+	block, rest, closed := strings.Cut(block, "}")
+	if !closed || strings.TrimSpace(rest) != "" {
+		return "", nil, fmt.Errorf("unterminated attributes in code fence info string '%s'", info)
+	}
+
+	tokens, err := splitQuoted(block)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w in code fence info string '%s'", err, info)
+	}
+
+	var attrs [][2]string
+	var classes []string
+	for _, token := range tokens {
+		switch {
+		case strings.HasPrefix(token, "."):
+			classes = append(classes, token[1:])
+		case strings.HasPrefix(token, "#"):
+			attrs = append(attrs, [2]string{"id", token[1:]})
+		case strings.HasPrefix(token, "=") && len(token) > 1:
+			attrs = append(attrs, [2]string{"format", token[1:]})
+		default:
+			name, value, found := strings.Cut(token, "=")
+			if !found || !isAttributeName(name) {
+				return "", nil, fmt.Errorf("invalid attribute '%s' in code fence info string", token)
+			}
+			attrs = append(attrs, [2]string{name, strings.Trim(value, "\"")})
+		}
+	}
+	if len(classes) > 0 {
+		attrs = append(attrs, [2]string{"class", strings.Join(classes, " ")})
+	}
+
+	return language, attrs, nil
+}
+
+// splitQuoted splits text at whitespace outside double quotes.
+func splitQuoted(text string) ([]string, error) {
+	var tokens []string
+	var token strings.Builder
+	quoted := false
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			token.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+		default:
+			token.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
+
+func isAttributeName(name string) bool {
+	if name == "" || name == "language" {
+		return false
+	}
+	for i, r := range name {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r) && r != '-') {
+			return false
+		}
+	}
+	return true
+}
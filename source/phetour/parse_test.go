@@ -0,0 +1,191 @@
+package phetour
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func TestParseDocumentFallsBackToPlainCode(t *testing.T) {
+	content := "# Bees\n\n> insects\n\nSee:\n\n> https://example.com Example\n\n```go\nfunc main() {}\n```\n"
+
+	doc, err := parseDocument(content, "bees.md", failingConverter{}, nil)
+	if err != nil {
+		t.Fatalf("parseDocument: %v", err)
+	}
+
+	// The page body is copied from the parsed one, as buildPost does.
+	body := etree.NewElement("body")
+	for _, child := range doc.FindElements("/document/body/*") {
+		copyElement(child, body)
+	}
+
+	link := body.SelectElement("link")
+	if link == nil {
+		t.Fatal("no link element")
+	}
+	if href := link.SelectAttrValue("href", ""); href != "https://example.com" {
+		t.Errorf("link href is %q, want https://example.com", href)
+	}
+	if link.Text() != "Example" {
+		t.Errorf("link text is %q, want Example", link.Text())
+	}
+
+	code := body.SelectElement("code")
+	if code == nil {
+		t.Fatal("no code element")
+	}
+	if language := code.SelectAttrValue("language", ""); language != "go" {
+		t.Errorf("code language is %q, want go", language)
+	}
+	if len(code.ChildElements()) != 0 {
+		t.Errorf("code holds elements after a failed conversion")
+	}
+	if code.Text() != "func main() {}" {
+		t.Errorf("code text is %q, want the block as written", code.Text())
+	}
+}
+
+func TestParseCodeBlockKeepsAngleBrackets(t *testing.T) {
+	const sample = "if (a < b && <int>) {}"
+	lines := []string{"```", sample, "```"}
+
+	code, next, err := parseCodeBlock(lines, 0, "sample.md", failingConverter{})
+	if err != nil {
+		t.Fatalf("parseCodeBlock: %v", err)
+	}
+	if next != len(lines) {
+		t.Errorf("parsing ends at line %d, want %d", next, len(lines))
+	}
+	if code.Text() != sample {
+		t.Errorf("code text is %q, want %q", code.Text(), sample)
+	}
+
+	// The sample must come back the same from the XML written to disk.
+	doc := etree.NewDocument()
+	doc.SetRoot(code)
+	written, err := doc.WriteToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reread := etree.NewDocument()
+	if err := reread.ReadFromString(written); err != nil {
+		t.Fatalf("reading back %q: %v", written, err)
+	}
+	if text := reread.Root().Text(); text != sample {
+		t.Errorf("code text read back is %q, want %q", text, sample)
+	}
+}
+
+func TestParseHeaderField(t *testing.T) {
+	huge := strings.Repeat("long ", 100000)
+	tests := []struct {
+		line  string
+		name  string
+		value string
+		ok    bool
+	}{
+		{"summary: A short one", "summary", "A short one", true},
+		{"author:Ռուբեն", "author", "Ռուբեն", true},
+		{"summary: [x] | y: \"z\", w", "summary", "[x] | y: \"z\", w", true},
+		{"summary: " + huge, "summary", strings.TrimSpace(huge), true},
+		{"summary:", "summary", "", true},
+		{": value", "", "", false},
+		{":", "", "", false},
+		{"", "", "", false},
+		{"Summary: capitalized", "", "", false},
+		{"summary : spaced", "", "", false},
+		{"Ռուբեն: not a field", "", "", false},
+		{strings.Repeat("x", 100000) + ": value", "", "", false},
+	}
+	for _, test := range tests {
+		name, value, ok := parseHeaderField(test.line)
+		if name != test.name || value != test.value || ok != test.ok {
+			t.Errorf("parseHeaderField(%.40q) = %q, %.40q, %t, want %q, %.40q, %t", test.line, name, value, ok, test.name, test.value, test.ok)
+		}
+	}
+}
+
+func TestParseDocumentAdversarialHeader(t *testing.T) {
+	content := "# \"Bees\" [and] | wasps, *maybe*\n" +
+		"> tag, with [brackets]\n" +
+		"> Ռուբեն\n" +
+		"summary: " + strings.Repeat("ա", 10000) + "\n" +
+		": not a field\n" +
+		"\nBody\n"
+
+	doc, err := parseDocument(content, "bees.md", failingConverter{}, nil)
+	if err != nil {
+		t.Fatalf("parseDocument: %v", err)
+	}
+
+	if title := doc.FindElement("/document/meta/title").SelectAttrValue("value", ""); title != `"Bees" [and] | wasps, *maybe*` {
+		t.Errorf("title is %q", title)
+	}
+	var tags []string
+	for _, tag := range doc.FindElements("/document/meta/tag") {
+		tags = append(tags, tag.SelectAttrValue("label", ""))
+	}
+	if strings.Join(tags, "/") != "tag, with [brackets]/Ռուբեն" {
+		t.Errorf("tags are %q", tags)
+	}
+	if summary := doc.FindElement("/document/meta/summary").SelectAttrValue("value", ""); summary != strings.Repeat("ա", 10000) {
+		t.Errorf("summary is %.40q, want the whole value", summary)
+	}
+
+	// A line that only looks like a field ends the header and starts the
+	// body.
+	texts := doc.FindElements("/document/body/text")
+	if len(texts) != 2 || texts[0].Text() != ": not a field" || texts[1].Text() != "Body" {
+		t.Errorf("body texts are %d, want ': not a field' and 'Body'", len(texts))
+	}
+}
+
+func TestParseDocumentEmptyHeaderValue(t *testing.T) {
+	_, err := parseDocument("# Bees\nsummary:\n\nBody\n", "bees.md", failingConverter{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "bees.md:2: empty value for summary") {
+		t.Errorf("error is %v, want the empty summary on line 2", err)
+	}
+}
+
+func TestParseDocumentEscapedLines(t *testing.T) {
+	content := "# Bees\n> insects\n\\date: not a field\n\n\\# not a heading\n\n\\\\# one backslash\n\n\\LaTeX, kept \\as written\n"
+
+	doc, err := parseDocument(content, "bees.md", failingConverter{}, nil)
+	if err != nil {
+		t.Fatalf("parseDocument: %v", err)
+	}
+	if doc.FindElement("/document/meta/date") != nil {
+		t.Error("escaped date line read as a header field")
+	}
+
+	var got []string
+	for _, text := range doc.FindElements("/document/body/text") {
+		got = append(got, text.Text())
+	}
+	want := []string{"date: not a field", "# not a heading", `\# one backslash`, `LaTeX, kept \as written`}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("texts are %q, want %q", got, want)
+	}
+}
+
+func TestParseDocumentLoneBackslash(t *testing.T) {
+	content := "# Bees\n\nfirst\n\\\nlast \\\nbroken\n"
+
+	doc, err := parseDocument(content, "bees.md", failingConverter{}, nil)
+	if err != nil {
+		t.Fatalf("parseDocument: %v", err)
+	}
+
+	text := doc.FindElement("/document/body/text")
+	if breaks := text.SelectElements("break"); len(breaks) != 1 {
+		t.Errorf("text has %d breaks, want only the one after 'last'", len(breaks))
+	}
+	if got := innerText(text); got != "first\n\\\nlastbroken" {
+		t.Errorf("text is %q, want the lone backslash kept as a line", got)
+	}
+	if got := markdownLine(`\`); got != `\\` {
+		t.Errorf("markdownLine of a lone backslash is %q, want it escaped", got)
+	}
+}
@@ -0,0 +1,73 @@
+// Package phetour generates a static site from the posts, statics and
+// stylesheets below the working directory. The phetour command is a thin
+// wrapper around Generate and Serve; other programs can embed the same
+// pipeline, or run its steps one by one.
+package phetour
+
+import (
+	"os"
+	"time"
+)
+
+// Generate runs a full build: it loads the lock file and the posts, builds
+// the intermediate XML, applies every stylesheet and saves the lock file
+// with any new keys. Unless quiet is set, it ends with the build's report
+// on stderr. With StylesOnly set, it only applies the stylesheets again
+// when nothing but them changed since the previous build.
+func Generate(config *Config) error {
+	if config.StylesOnly && !config.DryRun {
+		report, err := Restyle(config)
+		if err != nil {
+			return err
+		}
+		if report != nil {
+			if !config.Quiet {
+				report.Write(os.Stderr)
+			}
+			return nil
+		}
+	}
+
+	keylock, err := LoadKeylock(config)
+	if err != nil {
+		return err
+	}
+
+	if err := warn(config, checkConverter(config)); err != nil {
+		return err
+	}
+
+	taxonomy := NewTaxonomy(keylock)
+
+	start := time.Now()
+	source, err := LoadSource(keylock, taxonomy, config)
+	if err != nil {
+		return err
+	}
+
+	if err := warn(config, Validate(source, taxonomy)); err != nil {
+		return err
+	}
+	loading := Stage{Name: "load", Duration: time.Since(start)}
+
+	report, err := Build(source, taxonomy, config)
+	if err != nil {
+		return err
+	}
+	if config.DryRun {
+		return nil
+	}
+
+	// A preview builds drafts and scheduled posts, whose IDs only become
+	// lasting once a regular build publishes them.
+	if !config.Preview {
+		if err := keylock.Save(config); err != nil {
+			return err
+		}
+	}
+	if !config.Quiet {
+		report.Stages = append([]Stage{loading}, report.Stages...)
+		report.Write(os.Stderr)
+	}
+	return nil
+}
@@ -0,0 +1,488 @@
+package phetour
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	postsPath = "./input/posts"
+)
+
+type Post struct {
+	Name        string
+	Title       string
+	Key         int
+	Content     *etree.Document
+	Tags        []int
+	Summary     string
+	Author      string
+	Slug        string
+	Image       string
+	Style       string
+	Section     int
+	Unlisted    bool
+	BareLayout  bool
+	Series      int
+	SeriesOrder int
+	Date        time.Time
+	Updated     time.Time
+	Modified    time.Time
+}
+
+// Source holds the posts of a build, and counts the ones left out of it.
+// NextScheduled is the earliest date of the scheduled posts, zero when
+// there are none.
+type Source struct {
+	Posts         []Post
+	Drafts        int
+	Scheduled     int
+	NextScheduled time.Time
+}
+
+func LoadSource(keylock *Keylock, taxonomy *Taxonomy, config *Config) (*Source, error) {
+	source := &Source{Posts: []Post{}}
+	var postErrs []error
+
+	// Names are relative to the folder a post is found in, so that a folder
+	// may be added to postsPaths without changing the keys of its posts.
+	// Two posts with the same name would share a key.
+	found := map[string]string{}
+	for _, postsDir := range config.PostsPaths {
+		err := filepath.Walk(postsDir, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// Keys are made from the path below the posts folder, so that
+			// posts with the same file name in different folders stay apart.
+			relPath, err := filepath.Rel(postsDir, path)
+			if err != nil {
+				return err
+			}
+
+			if relPath != "." && config.Ignore.Matches(filepath.ToSlash(relPath), info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				return nil
+			}
+			// No file system should give a file without a name, but a
+			// broken one must not make it look like a post without one.
+			if info.Name() == "" {
+				postErrs = append(postErrs, fmt.Errorf("file with an empty name found in %s", filepath.Dir(path)))
+				return nil
+			}
+			if !slices.Contains(config.PostExtensions, strings.ToLower(filepath.Ext(info.Name()))) {
+				return nil
+			}
+			name := filepath.ToSlash(relPath)
+			if isDraftName(info.Name(), config) {
+				if !config.Drafts {
+					source.Drafts++
+					return nil
+				}
+				// An included draft is named as it will be once published,
+				// so that it keeps its key then.
+				name = filepath.ToSlash(filepath.Join(filepath.Dir(relPath), strings.TrimPrefix(info.Name(), config.DraftPrefix)))
+			}
+			if other, ok := found[name]; ok {
+				postErrs = append(postErrs, fmt.Errorf("posts %s and %s have the same name %s and would share a key", other, path, name))
+				return nil
+			}
+			found[name] = path
+
+			post, err := loadPost(path, name, keylock, taxonomy, config)
+			if errors.Is(err, errDraft) {
+				source.Drafts++
+				return nil
+			}
+			if errors.Is(err, errScheduled) {
+				source.Scheduled++
+				if source.NextScheduled.IsZero() || post.Date.Before(source.NextScheduled) {
+					source.NextScheduled = post.Date
+				}
+				return nil
+			}
+			if err != nil {
+				postErrs = append(postErrs, fmt.Errorf("failed loading post %s: %w", path, err))
+				return nil
+			}
+
+			source.Posts = append(source.Posts, post)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed reading posts folder %s: %w", postsDir, err)
+		}
+	}
+	if len(postErrs) > 0 {
+		return nil, errors.Join(postErrs...)
+	}
+
+	if err := checkSlugs(source, keylock, config); err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// isDraftName reports whether a file name starts with draftPrefix, which
+// marks a draft; an empty draftPrefix marks none.
+func isDraftName(name string, config *Config) bool {
+	return config.DraftPrefix != "" && strings.HasPrefix(name, config.DraftPrefix)
+}
+
+// validSlug accepts a single path segment of letters, digits, '-' and '_'.
+// Anything starting with "0x" is refused, since those directory names are
+// reserved for keys, and so is the directory of the tags index.
+func validSlug(slug string) bool {
+	if slug == "" || strings.HasPrefix(strings.ToLower(slug), "0x") || slug == tagsIndexDir {
+		return false
+	}
+	for _, r := range slug {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkSlugs reports every slug claimed by more than one post, since those
+// posts would overwrite each other's output, and every slug that is also
+// the directory name of a key. Keys that render alike, which only hashing
+// can cause, are reported the same way.
+func checkSlugs(source *Source, keylock *Keylock, config *Config) error {
+	var errs []error
+
+	keyNames := map[string]string{}
+	for _, key := range keylock.Keys {
+		name := FormatKey(key.ID, config)
+		if other, taken := keyNames[name]; taken {
+			errs = append(errs, fmt.Errorf("keys of %s and %s both render as '%s'", other, key.Value, name))
+		}
+		keyNames[name] = key.Value
+	}
+
+	owners := map[string][]string{}
+	var slugs []string
+	for _, post := range source.Posts {
+		if post.Slug == "" {
+			continue
+		}
+		if _, seen := owners[post.Slug]; !seen {
+			slugs = append(slugs, post.Slug)
+		}
+		owners[post.Slug] = append(owners[post.Slug], post.Name)
+	}
+
+	for _, slug := range slugs {
+		if names := owners[slug]; len(names) > 1 {
+			errs = append(errs, fmt.Errorf("posts %s share the slug '%s'", strings.Join(names, ", "), slug))
+		}
+		if value, taken := keyNames[slug]; taken {
+			errs = append(errs, fmt.Errorf("slug '%s' of post %s is the directory name of %s", slug, owners[slug][0], value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func loadPost(path string, name string, keylock *Keylock, taxonomy *Taxonomy, config *Config) (Post, error) {
+	contentBytes, err := os.ReadFile(path)
+	if err != nil {
+		return Post{}, fmt.Errorf("failed reading file: %w", err)
+	}
+
+	document, err := readPostDocument(normalizeText(string(contentBytes)), path, config.Converter, config.ParagraphConverter)
+	if err != nil {
+		return Post{}, fmt.Errorf("failed parsing document: %w", err)
+	}
+	if config.SmartTypography {
+		smartenPost(document)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return Post{}, fmt.Errorf("failed reading file: %w", err)
+	}
+
+	post := Post{
+		Name:     name,
+		Key:      keylock.AssureKey("POST:" + name),
+		Content:  document,
+		Modified: info.ModTime(),
+	}
+
+	// A modification time later than the build would make a build pinned
+	// with SOURCE_DATE_EPOCH depend on when the files were checked out.
+	if post.Modified.After(config.BuildTime) {
+		post.Modified = config.BuildTime
+	}
+
+	if err := extractPostMeta(&post, path, taxonomy, config); err != nil {
+		// A scheduled post still tells its date, for the manifest to
+		// record when it is due.
+		if errors.Is(err, errScheduled) {
+			return post, err
+		}
+		return Post{}, fmt.Errorf("failed reading meta: %w", err)
+	}
+
+	if body := document.Root().SelectElement("body"); body != nil {
+		warnings := checkFootnotes(body)
+		for i, warning := range warnings {
+			warnings[i] = path + ": " + warning
+		}
+		if err := warn(config, warnings); err != nil {
+			return Post{}, err
+		}
+	}
+
+	if post.Slug == "" && config.AutoSlug {
+		if slug := slugify(post.Title); validSlug(slug) {
+			post.Slug = slug
+		}
+	}
+
+	return post, nil
+}
+
+func readPostDocument(content string, path string, converter Converter, paragraphs Converter) (*etree.Document, error) {
+	var firstLine string
+	for _, line := range strings.Split(content, "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			firstLine = trimmed
+			break
+		}
+	}
+
+	if strings.HasPrefix(firstLine, "#") {
+		return parseDocument(content, path, converter, paragraphs)
+	}
+	if firstLine == tomlDelimiter || strings.HasPrefix(firstLine, "{") {
+		return parseFrontMatterDocument(content, path, converter, paragraphs)
+	}
+
+	return normalizeDocument(content)
+}
+
+// errScheduled is returned for a post dated after the build, which is left
+// out until a later build catches up with its date.
+var errScheduled = errors.New("post is scheduled for later")
+
+// errDraft is returned for a post marked as a draft, which is left out of
+// the build altogether.
+var errDraft = errors.New("post is a draft")
+
+// dateLayouts lists the accepted forms of the date field. Dates without a
+// time are taken as midnight local time.
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date '%s': use YYYY-MM-DD, YYYY-MM-DD HH:MM or RFC 3339", value)
+}
+
+// lastUpdate is when a post last changed as far as readers are concerned:
+// its updated field, its date, or the modification time of its source
+// file, whichever it has first.
+func lastUpdate(post Post) time.Time {
+	if !post.Updated.IsZero() {
+		return post.Updated
+	}
+	if !post.Date.IsZero() {
+		return post.Date
+	}
+	return post.Modified
+}
+
+// metaError reports a value of the meta element elem of the post at path
+// that cannot be used, at the header line the parsers record in its line
+// attribute. A post written as XML has none, and gets no line.
+func metaError(path string, elem *etree.Element, format string, args ...any) error {
+	line, _ := strconv.Atoi(elem.SelectAttrValue("line", ""))
+	return &ParseError{Path: path, Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+func extractPostMeta(post *Post, path string, taxonomy *Taxonomy, config *Config) error {
+	meta := post.Content.Root().SelectElement("meta")
+	if meta == nil {
+		return fmt.Errorf("no meta element found")
+	}
+	if err := expandEnvAttrs(meta); err != nil {
+		return err
+	}
+
+	titleElem := meta.SelectElement("title")
+	if titleElem == nil {
+		return fmt.Errorf("no title element found")
+	}
+
+	post.Title = titleElem.SelectAttrValue("value", "")
+	if post.Title == "" {
+		return metaError(path, titleElem, "title value is empty")
+	}
+
+	// The date and draft fields come before anything is registered in the
+	// taxonomy, so that a post left out leaves no trace in the build.
+	if draftElem := meta.SelectElement("draft"); draftElem != nil {
+		draft, err := strconv.ParseBool(draftElem.SelectAttrValue("value", ""))
+		if err != nil {
+			return metaError(path, draftElem, "invalid draft value '%s': use true or false", draftElem.SelectAttrValue("value", ""))
+		}
+		if draft && !config.Drafts {
+			return errDraft
+		}
+	}
+	// An unlisted post is built, but mentions nothing, so that no tag,
+	// author or section page lists it.
+	if unlistedElem := meta.SelectElement("unlisted"); unlistedElem != nil {
+		unlisted, err := strconv.ParseBool(unlistedElem.SelectAttrValue("value", ""))
+		if err != nil {
+			return metaError(path, unlistedElem, "invalid unlisted value '%s': use true or false", unlistedElem.SelectAttrValue("value", ""))
+		}
+		post.Unlisted = unlisted
+	}
+	if bareElem := meta.SelectElement("bareLayout"); bareElem != nil {
+		bare, err := strconv.ParseBool(bareElem.SelectAttrValue("value", ""))
+		if err != nil {
+			return metaError(path, bareElem, "invalid bareLayout value '%s': use true or false", bareElem.SelectAttrValue("value", ""))
+		}
+		post.BareLayout = bare
+	}
+	if dateElem := meta.SelectElement("date"); dateElem != nil {
+		date, err := parseDate(dateElem.SelectAttrValue("value", ""))
+		if err != nil {
+			return metaError(path, dateElem, "%v", err)
+		}
+		post.Date = date
+		if date.After(config.BuildTime) && !config.Future {
+			return errScheduled
+		}
+	}
+	if updatedElem := meta.SelectElement("updated"); updatedElem != nil {
+		updated, err := parseDate(updatedElem.SelectAttrValue("value", ""))
+		if err != nil {
+			return metaError(path, updatedElem, "%v", err)
+		}
+		post.Updated = updated
+	}
+
+	for _, tagElem := range meta.SelectElements("tag") {
+		// Labels are keyed with their whitespace collapsed, so that a
+		// stray space does not make a tag of its own.
+		tagLabel := strings.Join(strings.Fields(tagElem.SelectAttrValue("label", "")), " ")
+		if tagLabel == "" {
+			return fmt.Errorf("tag element with empty label found")
+		}
+		t := taxonomy.AssureTag(tagLabel)
+		if !post.Unlisted {
+			t.AssureMention(post.Key)
+		}
+		if !slices.Contains(post.Tags, t.Key) {
+			post.Tags = append(post.Tags, t.Key)
+		}
+	}
+
+	if authorElem := meta.SelectElement("author"); authorElem != nil {
+		post.Author = authorElem.SelectAttrValue("value", "")
+		if post.Author == "" {
+			return metaError(path, authorElem, "author element with empty value found")
+		}
+		author := taxonomy.AssureAuthor(post.Author)
+		if !post.Unlisted {
+			author.AssureMention(post.Key)
+		}
+	}
+
+	if sectionElem := meta.SelectElement("section"); sectionElem != nil {
+		label := strings.Join(strings.Fields(sectionElem.SelectAttrValue("value", "")), " ")
+		if label == "" {
+			return metaError(path, sectionElem, "section element with empty value found")
+		}
+		section := taxonomy.AssureSection(label)
+		if !post.Unlisted {
+			section.AssureMention(post.Key)
+		}
+		post.Section = section.Key
+	}
+
+	if seriesElem := meta.SelectElement("series"); seriesElem != nil {
+		label := strings.Join(strings.Fields(seriesElem.SelectAttrValue("value", "")), " ")
+		if label == "" {
+			return metaError(path, seriesElem, "series element with empty value found")
+		}
+		series := taxonomy.AssureSeries(label)
+		if !post.Unlisted {
+			series.AssureMention(post.Key)
+		}
+		post.Series = series.Key
+	}
+	if orderElem := meta.SelectElement("seriesOrder"); orderElem != nil {
+		value := orderElem.SelectAttrValue("value", "")
+		order, err := strconv.Atoi(value)
+		if err != nil || order <= 0 {
+			return metaError(path, orderElem, "invalid seriesOrder '%s': use a positive number", value)
+		}
+		if post.Series == 0 {
+			return metaError(path, orderElem, "seriesOrder without series")
+		}
+		post.SeriesOrder = order
+	}
+
+	if slugElem := meta.SelectElement("slug"); slugElem != nil {
+		post.Slug = slugElem.SelectAttrValue("value", "")
+		if !validSlug(post.Slug) {
+			return metaError(path, slugElem, "invalid slug '%s': use letters, digits, '-' and '_', not starting with 0x, and not %s", post.Slug, tagsIndexDir)
+		}
+	}
+
+	if imageElem := meta.SelectElement("image"); imageElem != nil {
+		post.Image = imageElem.SelectAttrValue("value", "")
+	}
+
+	if styleElem := meta.SelectElement("style"); styleElem != nil {
+		post.Style = styleElem.SelectAttrValue("value", "")
+		if post.Style == "" || strings.ContainsAny(post.Style, `/\.`) {
+			return metaError(path, styleElem, "invalid style '%s': name a directory of %s", post.Style, stylesInputPath)
+		}
+	}
+
+	if summaryElem := meta.SelectElement("summary"); summaryElem != nil {
+		post.Summary = summaryElem.SelectAttrValue("value", "")
+	}
+	if post.Summary == "" {
+		post.Summary = extractSummary(post.Content.Root().SelectElement("body"))
+	}
+
+	return nil
+}
+
+// extractSummary falls back to the first paragraph of the body when a post
+// declares no summary of its own.
+func extractSummary(body *etree.Element) string {
+	if body == nil {
+		return ""
+	}
+	text := body.SelectElement("text")
+	if text == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(innerText(text)), " ")
+}
@@ -0,0 +1,108 @@
+package phetour
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// fakeConverter stands in for pandoc, answering every block with the same
+// HTML and keeping what it was given.
+type fakeConverter struct {
+	html   string
+	inputs []string
+}
+
+func (converter *fakeConverter) Convert(markdown string) (*etree.Document, error) {
+	converter.inputs = append(converter.inputs, markdown)
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString("<fragment>" + converter.html + "</fragment>"); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// failingConverter stands in for a pandoc that fails on every block.
+type failingConverter struct{}
+
+func (failingConverter) Convert(string) (*etree.Document, error) {
+	return nil, errors.New("conversion failed")
+}
+
+// testConfig returns the default settings with a fixed build time, quiet,
+// so that tests neither depend on the clock nor print warnings.
+func testConfig() *Config {
+	config := defaultConfig()
+	config.BuildTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	config.Quiet = true
+	return config
+}
+
+func TestLoadPostUsesConfiguredConverter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bees.md")
+	content := "# Bees\n\n> insects\n\n# Hive\n\n- queen\n- worker\n\n> https://example.com Example\n\n```\n| a | b |\n```\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	converter := &fakeConverter{html: "<table><tr><td>a</td></tr></table>"}
+	config := testConfig()
+	config.Converter = converter
+	keylock := &Keylock{}
+
+	post, err := loadPost(path, "bees.md", keylock, NewTaxonomy(keylock), config)
+	if err != nil {
+		t.Fatalf("loadPost: %v", err)
+	}
+
+	if len(converter.inputs) != 1 || converter.inputs[0] != "| a | b |" {
+		t.Errorf("converter got %q, want the code block alone", converter.inputs)
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(post.Content.Root().SelectElement("body").Copy())
+	got, err := doc.WriteToString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<body>` +
+		`<bold>Hive</bold>` +
+		`<item>queen</item>` +
+		`<item>worker</item>` +
+		`<link href="https://example.com">Example</link>` +
+		`<code><table><tr><td>a</td></tr></table></code>` +
+		`</body>`
+	if got != want {
+		t.Errorf("body is\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLoadPostMetaErrorLine(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"# Bees\n> insects\ndate: yesterday\n\nBody\n", "bees.md:3: invalid date 'yesterday'"},
+		{"# Bees\ndraft: maybe\n\nBody\n", "bees.md:2: invalid draft value 'maybe'"},
+		{"# Bees\nseries: Hives\nseriesOrder: first\n\nBody\n", "bees.md:3: invalid seriesOrder 'first'"},
+		{"# Bees\n\nslug: 0x12\n", "bees.md:3: invalid slug '0x12'"},
+		{"+++\ntitle = \"Bees\"\nslug = \"0x12\"\n+++\n\nBody\n", "bees.md:3: invalid slug '0x12'"},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "bees.md")
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		keylock := &Keylock{}
+		_, err := loadPost(path, "bees.md", keylock, NewTaxonomy(keylock), testConfig())
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("loading %q: error is %v, want %q", test.content, err, test.want)
+		}
+	}
+}
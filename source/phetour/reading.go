@@ -0,0 +1,30 @@
+package phetour
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/beevik/etree"
+)
+
+// countWords counts the words of a post body, in the text extractText
+// gives, so prose counts and code does not. A word is any whitespace-
+// separated run containing at least one letter or digit, so punctuation
+// standing on its own is ignored in every script.
+func countWords(body *etree.Element) int {
+	words := 0
+	for _, field := range strings.Fields(extractText(body)) {
+		if strings.IndexFunc(field, func(r rune) bool {
+			return unicode.IsLetter(r) || unicode.IsDigit(r)
+		}) >= 0 {
+			words++
+		}
+	}
+	return words
+}
+
+// readingMinutes estimates the reading time at the given words per minute,
+// rounding up so that any non-empty post takes at least a minute.
+func readingMinutes(words int, speed int) int {
+	return (words + speed - 1) / speed
+}
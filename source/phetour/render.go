@@ -0,0 +1,597 @@
+package phetour
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// tagsIndexDir is the directory of the page listing every tag. Posts may
+// not take it as their slug.
+const tagsIndexDir = "tags"
+
+// FormatKey renders a key as it appears in directory names, hrefs and
+// listings, the way keyFormat asks for: in hex padded to keyWidth digits,
+// in decimal, in base 36, or as a hash that gives nothing away about how
+// many posts came before.
+func FormatKey(id int, config *Config) string {
+	switch config.KeyFormat {
+	case "decimal":
+		return strconv.Itoa(id)
+	case "base36":
+		return strconv.FormatInt(int64(id), 36)
+	case "hashed":
+		sum := sha256.Sum256([]byte("phetour key " + strconv.Itoa(id)))
+		return hex.EncodeToString(sum[:4])
+	}
+	return fmt.Sprintf("0x%0*x", config.KeyWidth, id)
+}
+
+// keyScheme names the way FormatKey renders keys under config.
+func keyScheme(config *Config) string {
+	if config.KeyFormat == "hex" {
+		return fmt.Sprintf("hex/%d", config.KeyWidth)
+	}
+	return config.KeyFormat
+}
+
+// Dir is the name of the directory a post is written to: its slug if it
+// has one, its hex key otherwise.
+func (post Post) Dir(config *Config) string {
+	dir := FormatKey(post.Key, config)
+	if post.Slug != "" {
+		dir = post.Slug
+	}
+	if config.NestSections && post.Section != 0 {
+		return FormatKey(post.Section, config) + "/" + dir
+	}
+	return dir
+}
+
+// comparePostsNewestFirst orders posts the way every listing and feed shows
+// them: dated posts first, the latest date first, then the posts without a
+// date, the most recently keyed first, as are posts sharing a date. The
+// modification time is left out, so the order is the same in every clone.
+func comparePostsNewestFirst(a, b Post) int {
+	if a.Date.IsZero() != b.Date.IsZero() {
+		if a.Date.IsZero() {
+			return 1
+		}
+		return -1
+	}
+	if c := b.Date.Compare(a.Date); c != 0 {
+		return c
+	}
+	return -cmp.Compare(a.Key, b.Key)
+}
+
+// copyElement appends a deep copy of src to parent. It is the one place
+// source content is carried into a page, so every element keeps the same
+// attributes, namespace prefixes included, and text keeps its CDATA form.
+func copyElement(src, parent *etree.Element) {
+	dst := parent.CreateElement(src.FullTag())
+	for _, attr := range src.Attr {
+		dst.CreateAttr(attr.FullKey(), attr.Value)
+	}
+	for _, child := range src.Child {
+		switch child := child.(type) {
+		case *etree.Element:
+			copyElement(child, dst)
+		case *etree.CharData:
+			if child.IsCData() {
+				dst.CreateCData(child.Data)
+			} else {
+				dst.CreateText(child.Data)
+			}
+		}
+	}
+}
+
+func buildPost(post Post, outputPath string, source *Source, taxonomy *Taxonomy, config *Config) error {
+	postDir := filepath.Join(outputPath, post.Dir(config))
+
+	doc := etree.NewDocument()
+	docRoot := doc.CreateElement("document")
+
+	srcRoot := post.Content.Root()
+	srcMeta := srcRoot.SelectElement("meta")
+
+	meta := docRoot.CreateElement("meta")
+	meta.CreateElement("title").CreateAttr("value", post.Title)
+	postTags := taxonomy.TagsOf(post)
+	for _, t := range postTags {
+		tag := meta.CreateElement("tag")
+		tag.CreateAttr("label", t.Label)
+		tag.CreateAttr("id", FormatKey(t.Key, config))
+	}
+
+	if post.Author != "" {
+		author := meta.CreateElement("author")
+		author.CreateAttr("value", post.Author)
+		for _, a := range taxonomy.Authors {
+			if a.Label == post.Author {
+				author.CreateAttr("id", FormatKey(a.Key, config))
+				break
+			}
+		}
+	}
+
+	section, hasSection := taxonomy.SectionOf(post)
+	if hasSection {
+		category := meta.CreateElement("category")
+		category.CreateAttr("value", section.Label)
+		category.CreateAttr("id", FormatKey(section.Key, config))
+	}
+
+	series, hasSeries := taxonomy.SeriesOf(post)
+	if hasSeries {
+		addSeriesNav(meta, post, series, source, config)
+	}
+
+	if post.Summary != "" {
+		meta.CreateElement("summary").CreateAttr("value", post.Summary)
+	}
+
+	// Dates keep the value as written, for display, next to a timestamp
+	// any stylesheet or script can parse.
+	if dateElem := srcMeta.SelectElement("date"); dateElem != nil {
+		date := meta.CreateElement("date")
+		date.CreateAttr("value", dateElem.SelectAttrValue("value", ""))
+		date.CreateAttr("timestamp", post.Date.Format(time.RFC3339))
+	}
+	if updatedElem := srcMeta.SelectElement("updated"); updatedElem != nil {
+		updated := meta.CreateElement("updated")
+		updated.CreateAttr("value", updatedElem.SelectAttrValue("value", ""))
+		updated.CreateAttr("timestamp", post.Updated.Format(time.RFC3339))
+	}
+	meta.CreateElement("modified").CreateAttr("value", post.Modified.UTC().Format(time.RFC3339))
+	if post.Style != "" {
+		meta.CreateElement("style").CreateAttr("value", post.Style)
+	}
+	if post.Unlisted {
+		meta.CreateElement("unlisted")
+	}
+
+	addCanonical(meta, pageHref(post.Dir(config)), config)
+	addSocialMeta(meta, post, config)
+	if err := addJSONLD(meta, post, postTags, config); err != nil {
+		return err
+	}
+	addMenu(meta, config)
+
+	srcBody := srcRoot.SelectElement("body")
+	words := countWords(srcBody)
+	reading := meta.CreateElement("reading")
+	reading.CreateAttr("words", strconv.Itoa(words))
+	reading.CreateAttr("minutes", strconv.Itoa(readingMinutes(words, config.ReadingSpeed)))
+
+	body := docRoot.CreateElement("body")
+	// A bare layout, for landing pages and the like, leaves the body to
+	// the post alone, without the title and links put before it.
+	if !post.BareLayout {
+		body.CreateElement("bold").CreateText(post.Title)
+
+		for _, t := range postTags {
+			link := body.CreateElement("link")
+			link.CreateAttr("href", pageHref(FormatKey(t.Key, config)))
+			link.CreateText(FormatKey(t.Key, config) + " - " + t.Label)
+		}
+
+		for _, a := range taxonomy.Authors {
+			if a.Label == post.Author {
+				link := body.CreateElement("link")
+				link.CreateAttr("href", pageHref(FormatKey(a.Key, config)))
+				link.CreateText(FormatKey(a.Key, config) + " - " + a.Label)
+				break
+			}
+		}
+
+		if hasSection {
+			link := body.CreateElement("link")
+			link.CreateAttr("href", pageHref(FormatKey(section.Key, config)))
+			link.CreateText(FormatKey(section.Key, config) + " - " + section.Label)
+		}
+
+		if hasSeries {
+			link := body.CreateElement("link")
+			link.CreateAttr("href", pageHref(FormatKey(series.Key, config)))
+			link.CreateText(FormatKey(series.Key, config) + " - " + series.Label)
+		}
+	}
+
+	for _, child := range srcBody.Child {
+		if elem, ok := child.(*etree.Element); ok {
+			if slices.Contains(config.BodyElements, elem.Tag) {
+				copyElement(elem, body)
+			}
+		} else if charData, ok := child.(*etree.CharData); ok {
+			body.CreateText(string(charData.Data))
+		}
+	}
+
+	if err := writePage(doc, filepath.Join(postDir, "index.xml"), config); err != nil {
+		return fmt.Errorf("failed to write post index.xml: %w", err)
+	}
+
+	return nil
+}
+
+// addSocialMeta adds the Open Graph and Twitter Card properties that link
+// previews are built from. Properties without a value are left out, and the
+// URLs only appear once baseURL makes them absolute.
+func addSocialMeta(meta *etree.Element, post Post, config *Config) {
+	image := post.Image
+	if strings.HasPrefix(image, "/") && config.BaseURL != "" {
+		image = absoluteURL(image, config)
+	}
+
+	url := absoluteURL(pageHref(post.Dir(config)), config)
+
+	card := "summary"
+	if image != "" {
+		card = "summary_large_image"
+	}
+
+	properties := []struct{ tag, name, value string }{
+		{"og", "og:type", "article"},
+		{"og", "og:title", post.Title},
+		{"og", "og:description", post.Summary},
+		{"og", "og:url", url},
+		{"og", "og:image", image},
+		{"twitter", "twitter:card", card},
+		{"twitter", "twitter:title", post.Title},
+		{"twitter", "twitter:description", post.Summary},
+		{"twitter", "twitter:image", image},
+	}
+	for _, property := range properties {
+		if property.value == "" {
+			continue
+		}
+		element := meta.CreateElement(property.tag)
+		element.CreateAttr("name", property.name)
+		element.CreateAttr("value", property.value)
+	}
+}
+
+// jsonLDPerson is the schema.org Person named as a post's author.
+type jsonLDPerson struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+// jsonLDArticle is the schema.org Article describing a post to search
+// engines. Properties the post has no value for are left out.
+type jsonLDArticle struct {
+	Context          string        `json:"@context"`
+	Type             string        `json:"@type"`
+	Headline         string        `json:"headline"`
+	Description      string        `json:"description,omitempty"`
+	DatePublished    string        `json:"datePublished,omitempty"`
+	DateModified     string        `json:"dateModified,omitempty"`
+	Author           *jsonLDPerson `json:"author,omitempty"`
+	Image            string        `json:"image,omitempty"`
+	URL              string        `json:"url,omitempty"`
+	MainEntityOfPage string        `json:"mainEntityOfPage,omitempty"`
+	Keywords         []string      `json:"keywords,omitempty"`
+}
+
+// addJSONLD adds the post's Article as JSON-LD, for stylesheets to copy
+// into a script element. It is kept in a CDATA section; the encoder escapes
+// <, > and &, so neither that section nor the script can end early.
+func addJSONLD(meta *etree.Element, post Post, tags []Tag, config *Config) error {
+	article := jsonLDArticle{
+		Context:      "https://schema.org",
+		Type:         "Article",
+		Headline:     post.Title,
+		Description:  post.Summary,
+		DateModified: lastUpdate(post).Format(time.RFC3339),
+		Image:        post.Image,
+		URL:          absoluteURL(pageHref(post.Dir(config)), config),
+	}
+	article.MainEntityOfPage = article.URL
+	if !post.Date.IsZero() {
+		article.DatePublished = post.Date.Format(time.RFC3339)
+	}
+	if post.Author != "" {
+		article.Author = &jsonLDPerson{Type: "Person", Name: post.Author}
+	}
+	if strings.HasPrefix(article.Image, "/") {
+		article.Image = absoluteURL(article.Image, config)
+	}
+	for _, tag := range tags {
+		article.Keywords = append(article.Keywords, tag.Label)
+	}
+
+	data, err := json.Marshal(article)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON-LD: %w", err)
+	}
+	meta.CreateElement("jsonld").CreateCData(string(data))
+	return nil
+}
+
+// pageHref returns the root-relative href of the page in dir, each of its
+// segments percent-encoded, so that a slug in any script makes a valid URL
+// while keys, being ASCII, come out as they are.
+func pageHref(dir string) string {
+	segments := strings.Split(dir, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return "/" + strings.Join(segments, "/") + "/"
+}
+
+// absoluteURL makes a site path absolute with baseURL. Without a baseURL
+// there is no absolute form, and it returns the empty string.
+func absoluteURL(path string, config *Config) string {
+	if config.BaseURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(config.BaseURL, "/") + path
+}
+
+// addCanonical records the one URL a page should be known by, so that
+// search engines do not count the same page reached another way twice.
+func addCanonical(meta *etree.Element, path string, config *Config) {
+	if url := absoluteURL(path, config); url != "" {
+		meta.CreateElement("canonical").CreateAttr("value", url)
+	}
+}
+
+// addMenu adds the site menu, so that every page can show the same header.
+func addMenu(meta *etree.Element, config *Config) {
+	for _, item := range config.Menu {
+		nav := meta.CreateElement("nav")
+		nav.CreateAttr("label", item.Label)
+		nav.CreateAttr("href", item.Href)
+	}
+}
+
+// buildTag writes the index page of a tag, or of an author, listing every
+// post that mentions it below its description, if it has one.
+func buildTag(tag Tag, description string, outputPath string, source *Source, config *Config) error {
+	tagDir := filepath.Join(outputPath, FormatKey(tag.Key, config))
+
+	doc := etree.NewDocument()
+	docRoot := doc.CreateElement("document")
+	meta := docRoot.CreateElement("meta")
+	meta.CreateElement("title").CreateAttr("value", tag.Label)
+	addCanonical(meta, pageHref(FormatKey(tag.Key, config)), config)
+	addMenu(meta, config)
+
+	body := docRoot.CreateElement("body")
+	body.CreateElement("bold").CreateText(tag.Label)
+	if description != "" {
+		body.CreateElement("text").CreateText(description)
+	}
+
+	var posts []Post
+	for _, mentionID := range tag.Mentions {
+		for _, post := range source.Posts {
+			if post.Key == mentionID {
+				posts = append(posts, post)
+				break
+			}
+		}
+	}
+
+	slices.SortFunc(posts, comparePostsNewestFirst)
+
+	for _, post := range posts {
+		link := body.CreateElement("link")
+		link.CreateAttr("href", pageHref(post.Dir(config)))
+		link.CreateText(fmt.Sprintf("%s - %s", FormatKey(post.Key, config), post.Title))
+	}
+
+	if err := writePage(doc, filepath.Join(tagDir, "index.xml"), config); err != nil {
+		return fmt.Errorf("failed to write tag index.xml: %w", err)
+	}
+
+	return nil
+}
+
+// listedPosts leaves out the unlisted posts, which are only reached by
+// their URL.
+func listedPosts(source *Source) []Post {
+	var posts []Post
+	for _, post := range source.Posts {
+		if !post.Unlisted {
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+// buildSection writes the index page of a section, listing its posts the
+// way a tag page does. With nestSections the posts' own pages sit below it.
+func buildSection(section Tag, outputPath string, source *Source, config *Config) error {
+	return buildTag(section, "", outputPath, source, config)
+}
+
+func buildHomeCatalog(source *Source, taxonomy *Taxonomy, outputPath string, config *Config) error {
+	doc := etree.NewDocument()
+	docRoot := doc.CreateElement("document")
+	meta := docRoot.CreateElement("meta")
+	meta.CreateElement("title").CreateAttr("value", config.SiteTitle)
+	addCanonical(meta, "/", config)
+	addMenu(meta, config)
+
+	body := docRoot.CreateElement("body")
+
+	slices.SortFunc(source.Posts, comparePostsNewestFirst)
+
+	posts := body.CreateElement("section")
+	posts.CreateAttr("name", "posts")
+	for _, post := range listedPosts(source) {
+		link := posts.CreateElement("link")
+		link.CreateAttr("href", pageHref(post.Dir(config)))
+		if post.Summary != "" {
+			link.CreateAttr("summary", post.Summary)
+		}
+		link.CreateText(fmt.Sprintf("%s - %s", FormatKey(post.Key, config), post.Title))
+	}
+
+	if config.HomeTags {
+		tags := body.CreateElement("section")
+		tags.CreateAttr("name", "tags")
+
+		slices.SortFunc(taxonomy.Tags, func(a, b Tag) int { return -cmp.Compare(a.Key, b.Key) })
+
+		for _, tag := range taxonomy.Tags {
+			if len(tag.Mentions) == 0 {
+				continue
+			}
+			link := tags.CreateElement("link")
+			link.CreateAttr("href", pageHref(FormatKey(tag.Key, config)))
+			link.CreateText(fmt.Sprintf("%s - %s", FormatKey(tag.Key, config), tag.Label))
+		}
+	}
+
+	if err := writePage(doc, filepath.Join(outputPath, "index.xml"), config); err != nil {
+		return fmt.Errorf("failed to write home catalog: %w", err)
+	}
+
+	return nil
+}
+
+// buildTagsIndex writes the page listing every tag, with the number of
+// posts that mention it, to the tags directory.
+func buildTagsIndex(taxonomy *Taxonomy, outputPath string, config *Config) error {
+	doc := etree.NewDocument()
+	docRoot := doc.CreateElement("document")
+	meta := docRoot.CreateElement("meta")
+	meta.CreateElement("title").CreateAttr("value", "Tags")
+	addCanonical(meta, pageHref(tagsIndexDir), config)
+	addMenu(meta, config)
+
+	body := docRoot.CreateElement("body")
+	body.CreateElement("bold").CreateText("Tags")
+
+	tags := slices.Clone(taxonomy.Tags)
+	slices.SortFunc(tags, func(a, b Tag) int { return -cmp.Compare(a.Key, b.Key) })
+
+	for _, tag := range tags {
+		if len(tag.Mentions) == 0 {
+			continue
+		}
+		link := body.CreateElement("link")
+		link.CreateAttr("href", pageHref(FormatKey(tag.Key, config)))
+		link.CreateAttr("count", strconv.Itoa(len(tag.Mentions)))
+		link.CreateText(fmt.Sprintf("%s - %s (%d)", FormatKey(tag.Key, config), tag.Label, len(tag.Mentions)))
+	}
+
+	if err := writePage(doc, filepath.Join(outputPath, tagsIndexDir, "index.xml"), config); err != nil {
+		return fmt.Errorf("failed to write tags index: %w", err)
+	}
+
+	return nil
+}
+
+// writePage checks a generated page against pageSchema before writing it,
+// so that stylesheets only ever see the vocabulary they were written for.
+func writePage(doc *etree.Document, path string, config *Config) error {
+	problems := checkPage(doc, config)
+	for i, problem := range problems {
+		problems[i] = path + ": " + problem
+	}
+	if err := warn(config, problems); err != nil {
+		return err
+	}
+	return writeDocument(doc, path, config)
+}
+
+// indentDocument indents doc the way the indent setting asks for. Every
+// XML file phetour writes goes through it.
+func indentDocument(doc *etree.Document, config *Config) {
+	if config.Indent == IndentTabs {
+		doc.IndentTabs()
+	} else {
+		doc.Indent(config.Indent)
+	}
+	unindentMixed(&doc.Element)
+}
+
+// unindentMixed drops the indentation etree puts between the text and the
+// inline elements of mixed content, where it would read as word spacing.
+func unindentMixed(element *etree.Element) {
+	mixed := false
+	for _, token := range element.Child {
+		if data, ok := token.(*etree.CharData); ok && !data.IsWhitespace() {
+			mixed = true
+		}
+	}
+	for i := len(element.Child) - 1; i >= 0; i-- {
+		switch token := element.Child[i].(type) {
+		case *etree.CharData:
+			if mixed && token.IsWhitespace() {
+				element.RemoveChildAt(i)
+			}
+		case *etree.Element:
+			unindentMixed(token)
+		}
+	}
+}
+
+// writeDocument indents doc and writes it to path.
+func writeDocument(doc *etree.Document, path string, config *Config) error {
+	indentDocument(doc, config)
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+	return writeOutput(path, data, config)
+}
+
+// writeOutput writes a generated file, creating its directory. In a dry run
+// the content goes to stdout instead, under a line naming the file it
+// would have been written to.
+func writeOutput(path string, data []byte, config *Config) error {
+	if config.DryRun {
+		fmt.Printf("==> %s <==\n", path)
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	if err := makeOutputDir(filepath.Dir(path), config); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, config.FileMode); err != nil {
+		return err
+	}
+	// The mode given to WriteFile is masked by the umask and ignored for
+	// files that already exist, so set it explicitly.
+	return os.Chmod(path, config.FileMode)
+}
+
+// makeOutputDir creates path and its missing parents with dirMode. Like
+// files, directories get their mode set explicitly, past the umask; ones
+// that already exist are left as they are.
+func makeOutputDir(path string, config *Config) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", path)
+		}
+		return nil
+	}
+	if parent := filepath.Dir(path); parent != path {
+		if err := makeOutputDir(parent, config); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(path, config.DirMode); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return os.Chmod(path, config.DirMode)
+}
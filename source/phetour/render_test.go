@@ -0,0 +1,120 @@
+package phetour
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFormatKey(t *testing.T) {
+	tests := []struct {
+		format string
+		width  int
+		id     int
+		want   string
+	}{
+		{"hex", 4, 1, "0x0001"},
+		{"hex", 4, 0xffff, "0xffff"},
+		{"hex", 4, 0x10000, "0x10000"},
+		{"hex", 6, 0x10000, "0x010000"},
+		{"hex", 0, 26, "0x1a"},
+		{"decimal", 4, 26, "26"},
+		{"base36", 4, 35, "z"},
+		{"base36", 4, 36, "10"},
+	}
+	for _, test := range tests {
+		config := testConfig()
+		config.KeyFormat = test.format
+		config.KeyWidth = test.width
+		if got := FormatKey(test.id, config); got != test.want {
+			t.Errorf("FormatKey(%d) as %s/%d = %q, want %q", test.id, test.format, test.width, got, test.want)
+		}
+	}
+}
+
+func TestFormatKeyHashed(t *testing.T) {
+	config := testConfig()
+	config.KeyFormat = "hashed"
+
+	seen := map[string]int{}
+	for id := 1; id <= 1000; id++ {
+		key := FormatKey(id, config)
+		if len(key) != 8 {
+			t.Errorf("FormatKey(%d) = %q, want 8 hex digits", id, key)
+		}
+		if key != FormatKey(id, config) {
+			t.Errorf("FormatKey(%d) differs between calls", id)
+		}
+		if other, ok := seen[key]; ok {
+			t.Errorf("FormatKey gives %q for both %d and %d", key, other, id)
+		}
+		seen[key] = id
+	}
+}
+
+func TestPostDir(t *testing.T) {
+	tests := []struct {
+		post Post
+		nest bool
+		want string
+	}{
+		{Post{Key: 2}, false, "0x0002"},
+		{Post{Key: 2, Slug: "bees"}, false, "bees"},
+		{Post{Key: 2, Section: 1}, false, "0x0002"},
+		{Post{Key: 2, Section: 1}, true, "0x0001/0x0002"},
+		{Post{Key: 2, Slug: "bees", Section: 1}, true, "0x0001/bees"},
+	}
+	for _, test := range tests {
+		config := testConfig()
+		config.NestSections = test.nest
+		if got := test.post.Dir(config); got != test.want {
+			t.Errorf("Dir of %+v with nestSections %t = %q, want %q", test.post, test.nest, got, test.want)
+		}
+	}
+}
+
+// BenchmarkBuildTag builds the page of a tag mentioned by 1000 posts, every
+// mention recorded twice, as a post listing its tag twice would.
+func BenchmarkBuildTag(b *testing.B) {
+	config := testConfig()
+	keylock := &Keylock{}
+	source := &Source{}
+	for i := range 1000 {
+		name := fmt.Sprintf("post-%d.md", i)
+		source.Posts = append(source.Posts, Post{Name: name, Key: keylock.AssureKey("POST:" + name), Title: name})
+	}
+	outputPath := b.TempDir()
+
+	for b.Loop() {
+		tag := NewTaxonomy(keylock).AssureTag("bees")
+		for _, post := range source.Posts {
+			tag.AssureMention(post.Key)
+			tag.AssureMention(post.Key)
+		}
+		if err := buildTag(*tag, "", outputPath, source, config); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestComparePostsNewestFirst(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	posts := []Post{
+		{Name: "undated-old", Key: 1, Modified: day(9)},
+		{Name: "dated-old", Key: 2, Date: day(1)},
+		{Name: "undated-new", Key: 3, Modified: day(2)},
+		{Name: "dated-new", Key: 4, Date: day(5)},
+		{Name: "dated-same", Key: 5, Date: day(5)},
+	}
+	slices.SortFunc(posts, comparePostsNewestFirst)
+
+	var got []string
+	for _, post := range posts {
+		got = append(got, post.Name)
+	}
+	want := []string{"dated-same", "dated-new", "dated-old", "undated-new", "undated-old"}
+	if !slices.Equal(got, want) {
+		t.Errorf("order is %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+package phetour
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Report tells what a build did: how many of each thing it built, how many
+// posts it skipped, and how long each of its stages took. Restyled marks a
+// build -styles that reused the XML of the previous build.
+type Report struct {
+	Restyled    bool
+	Posts       int
+	Drafts      int
+	Scheduled   int
+	Tags        int
+	Authors     int
+	Sections    int
+	Statics     int
+	Stylesheets int
+	Outputs     int
+	Stages      []Stage
+}
+
+// Stage is a named step of a build and the time it took.
+type Stage struct {
+	Name     string
+	Duration time.Duration
+}
+
+// timeStage records the stage that started at start and ends now.
+func (report *Report) timeStage(name string, start time.Time) {
+	report.Stages = append(report.Stages, Stage{Name: name, Duration: time.Since(start)})
+}
+
+// Write prints the report in a few lines, as the build command shows it.
+func (report *Report) Write(w io.Writer) {
+	if report.Restyled {
+		fmt.Fprintf(w, "reused the XML of the previous build, applied %s, %s in the output\n",
+			count(report.Stylesheets, "stylesheet"), count(report.Outputs, "file"))
+		report.writeStages(w)
+		return
+	}
+
+	fmt.Fprintf(w, "built %s, %s, %s and %s\n",
+		count(report.Posts, "post"), count(report.Tags, "tag"), count(report.Authors, "author"), count(report.Sections, "section"))
+	if report.Drafts > 0 || report.Scheduled > 0 {
+		fmt.Fprintf(w, "skipped %s and %s\n", count(report.Drafts, "draft"), count(report.Scheduled, "scheduled post"))
+	}
+	fmt.Fprintf(w, "copied %s, applied %s, %s in the output\n",
+		count(report.Statics, "static"), count(report.Stylesheets, "stylesheet"), count(report.Outputs, "file"))
+	report.writeStages(w)
+}
+
+// writeStages prints the time the build took, stage by stage.
+func (report *Report) writeStages(w io.Writer) {
+	var total time.Duration
+	var stages []string
+	for _, stage := range report.Stages {
+		total += stage.Duration
+		stages = append(stages, fmt.Sprintf("%s %s", stage.Name, roundDuration(stage.Duration)))
+	}
+	fmt.Fprintf(w, "took %s: %s\n", roundDuration(total), strings.Join(stages, ", "))
+}
+
+// roundDuration rounds to milliseconds, or to microseconds for what took
+// less than one.
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+// count writes n with noun, plural unless n is one.
+func count(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,194 @@
+package phetour
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// sourcesFingerprint hashes everything the intermediate XML is built from
+// except the stylesheets: the posts, partials and statics, by size and
+// modification time, the config, with the environment variables it names
+// expanded, the tag descriptions and ignore file, by content, and the flags
+// that change which posts are built. The keys are hashed as keylock holds
+// them rather than as the lock file does, since a build adds the keys of
+// new posts before it saves them: a build passes the keys it builds with,
+// build -styles the ones the lock file holds since. The build time is not
+// in it; the manifest records when the next scheduled post is due instead.
+func sourcesFingerprint(keylock *Keylock, config *Config) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "future=%t drafts=%t bundle=%t\n", config.Future, config.Drafts, config.Bundle)
+	for _, key := range keylock.Keys {
+		fmt.Fprintf(hash, "key %d %s\n", key.ID, key.Value)
+	}
+
+	for _, path := range []string{configFilePath, tagsFilePath, ignoreFilePath} {
+		content, err := os.ReadFile(path)
+		if err == nil && path == configFilePath {
+			content, err = expandConfig(content)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		fmt.Fprintf(hash, "%s %d\n", path, len(content))
+		hash.Write(content)
+	}
+
+	dirs := append(slices.Clone(config.PostsPaths), partialsPath, staticsInputPath)
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "%s %d %d\n", filepath.ToSlash(path), info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to fingerprint %s: %w", dir, err)
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Restyle applies the stylesheets again to the XML of the previous build,
+// without loading a single post, as build -styles does. It returns a nil
+// report when that XML cannot be reused, because there is no previous
+// build or some input other than the stylesheets changed since; a full
+// build is needed then.
+func Restyle(config *Config) (*Report, error) {
+	xmlOutputPath := filepath.Join(config.OutputPath, "xml")
+
+	manifest, err := LoadManifest(config.OutputPath)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil || manifest.Sources == "" {
+		return nil, nil
+	}
+	keylock, err := LoadKeylock(config)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := sourcesFingerprint(keylock, config)
+	if err != nil {
+		return nil, err
+	}
+	if sources != manifest.Sources {
+		return nil, nil
+	}
+	// A post scheduled for a time since passed is to be published.
+	if !manifest.Scheduled.IsZero() && !manifest.Scheduled.After(config.BuildTime) {
+		return nil, nil
+	}
+
+	xslFiles, err := findStylesheets(stylesInputPath)
+	if err != nil {
+		return nil, err
+	}
+	styleDirectories, primaryFound := styleOutputDirectories(xslFiles, config)
+	ownedDirectories := append([]string{"xml"}, styleDirectories...)
+	if config.PrimaryStyle != "" {
+		if !primaryFound {
+			return nil, fmt.Errorf("primary style %s has no stylesheet in %s", config.PrimaryStyle, stylesInputPath)
+		}
+		ownedDirectories = append(ownedDirectories, ".")
+	}
+
+	previous := manifest.Hashes()
+	foreign, err := foreignFiles(config.OutputPath, ownedDirectories, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	styles, err := pageStyles(xmlOutputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	statics := map[string]bool{}
+	for _, file := range manifest.Files {
+		if file.Static {
+			statics[filepath.Join(config.OutputPath, filepath.FromSlash(file.Path))] = true
+		}
+	}
+
+	report := &Report{Restyled: true, Stylesheets: len(xslFiles), Statics: len(statics)}
+
+	start := time.Now()
+	produced, applied, err := applyStylesheets(xmlOutputPath, xslFiles, styles, config, previous, manifest.StyleParams())
+	if err != nil {
+		// The pages written before the failure are still phetour's own.
+		err = fmt.Errorf("failed to apply stylesheets: %w", err)
+		return nil, errors.Join(err, savePartialManifest(ownedDirectories, foreign, statics, config))
+	}
+	report.Outputs = len(produced)
+	report.timeStage("stylesheets", start)
+
+	if err := removeStale(config.OutputPath, leftoverPaths(config.OutputPath, manifest, produced)); err != nil {
+		return nil, err
+	}
+
+	keys, scheduled := manifest.Keys, manifest.Scheduled
+	manifest, err = NewManifest(config.OutputPath, ownedDirectories, foreign, statics)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Keys = keys
+	manifest.Sources = sources
+	manifest.Scheduled = scheduled
+	manifest.Params = applied
+	return report, manifest.Save(config)
+}
+
+// pageStyles finds the pages of posts with a style field in the XML of a
+// previous build, keyed like the styles Build passes to applyStylesheets.
+func pageStyles(xmlOutputPath string) (map[string]string, error) {
+	styles := map[string]string{}
+	err := filepath.WalkDir(xmlOutputPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || entry.Name() != "index.xml" {
+			return nil
+		}
+
+		doc := etree.NewDocument()
+		if err := doc.ReadFromFile(path); err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		style := doc.FindElement("/document/meta/style")
+		if style == nil {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(xmlOutputPath, path)
+		if err != nil {
+			return err
+		}
+		styles[filepath.ToSlash(relPath)] = style.SelectAttrValue("value", "")
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the XML of the previous build: %w", err)
+	}
+	return styles, nil
+}
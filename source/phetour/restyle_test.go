@@ -0,0 +1,21 @@
+package phetour
+
+import "testing"
+
+func TestSourcesFingerprintCoversKeys(t *testing.T) {
+	config := testConfig()
+	keylock := &Keylock{Keys: []Key{{ID: 1, Value: "POST:a.md"}, {ID: 2, Value: "TAG:essays"}}}
+	before, err := sourcesFingerprint(keylock, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keylock.Keys[1].ID = 7
+	after, err := sourcesFingerprint(keylock, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Error("fingerprint unchanged after a key got another ID")
+	}
+}
@@ -0,0 +1,37 @@
+package phetour
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// buildRobots writes robots.txt next to the generated XML, so that it is
+// copied into the output of every stylesheet. Nothing is written unless the
+// config has a robots element.
+func buildRobots(config *Config, outputPath string) error {
+	if config.Robots == nil {
+		return nil
+	}
+
+	var builder strings.Builder
+	builder.WriteString("User-agent: *\n")
+	if len(config.Robots.Disallow) == 0 {
+		builder.WriteString("Disallow:\n")
+	}
+	for _, path := range config.Robots.Disallow {
+		fmt.Fprintf(&builder, "Disallow: %s\n", path)
+	}
+	sitemap := config.Robots.Sitemap
+	if sitemap == "" && config.BaseURL != "" {
+		sitemap = strings.TrimSuffix(config.BaseURL, "/") + "/sitemap.xml"
+	}
+	if sitemap != "" {
+		fmt.Fprintf(&builder, "\nSitemap: %s\n", sitemap)
+	}
+
+	if err := writeOutput(filepath.Join(outputPath, "robots.txt"), []byte(builder.String()), config); err != nil {
+		return fmt.Errorf("failed to write robots.txt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package phetour
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// elementSchema describes an element of the generated pages: the
+// attributes it must and may carry, and what it may contain. An empty
+// children list with text set means text only.
+type elementSchema struct {
+	required []string
+	optional []string
+	anyAttrs bool
+	children []string
+	anyBody  bool
+	text     bool
+}
+
+// defaultBodyElements are the content blocks a post body may hold. The
+// bodyElement config setting adds to them.
+var defaultBodyElements = []string{"bold", "text", "code", "item", "link", "html", "footnote", "table"}
+
+// generatedBodyElements are the body elements only phetour itself writes,
+// into the pages it puts together, and which posts cannot use.
+var generatedBodyElements = []string{"section"}
+
+// pageSchema is the vocabulary stylesheets can rely on. The readme
+// documents the same elements.
+var pageSchema = map[string]elementSchema{
+	"document": {children: []string{"meta", "body"}},
+	"meta": {children: []string{
+		"title", "tag", "author", "category", "series", "previous", "next", "summary", "date", "updated", "modified", "og", "twitter", "reading", "nav", "canonical", "style", "unlisted", "jsonld",
+	}},
+	"title":        {required: []string{"value"}},
+	"tag":          {required: []string{"label"}, optional: []string{"id"}},
+	"author":       {required: []string{"value"}, optional: []string{"id"}},
+	"category":     {required: []string{"value"}, optional: []string{"id"}},
+	"series":       {required: []string{"value"}, optional: []string{"id", "part", "parts"}},
+	"previous":     {required: []string{"href", "title"}},
+	"next":         {required: []string{"href", "title"}},
+	"summary":      {required: []string{"value"}},
+	"date":         {required: []string{"value", "timestamp"}},
+	"updated":      {required: []string{"value", "timestamp"}},
+	"modified":     {required: []string{"value"}},
+	"og":           {required: []string{"name", "value"}},
+	"twitter":      {required: []string{"name", "value"}},
+	"reading":      {required: []string{"words", "minutes"}},
+	"nav":          {required: []string{"label", "href"}},
+	"canonical":    {required: []string{"value"}},
+	"style":        {required: []string{"value"}},
+	"unlisted":     {},
+	"jsonld":       {text: true},
+	"bold":         {optional: []string{"id"}, text: true},
+	"text":         {text: true, children: append([]string{"break", "footnote-ref"}, inlineElements...)},
+	"emphasis":     {text: true, children: append([]string{"break", "footnote-ref"}, inlineElements...)},
+	"strong":       {text: true, children: append([]string{"break", "footnote-ref"}, inlineElements...)},
+	"break":        {},
+	"section":      {required: []string{"name"}, children: []string{"link"}},
+	"item":         {text: true, children: []string{"footnote-ref"}},
+	"link":         {required: []string{"href"}, optional: []string{"summary", "count"}, text: true},
+	"code":         {anyAttrs: true, anyBody: true, text: true},
+	"html":         {text: true},
+	"table":        {children: []string{"row"}},
+	"row":          {optional: []string{"header"}, children: []string{"cell"}},
+	"cell":         {optional: []string{"align"}, text: true, children: []string{"footnote-ref"}},
+	"footnote":     {required: []string{"id"}, optional: []string{"number"}, text: true, children: []string{"footnote-ref"}},
+	"footnote-ref": {required: []string{"id"}, optional: []string{"number"}},
+}
+
+// checkPage reports every place where a generated page strays from
+// pageSchema. The body may hold the configured body elements; those added
+// by the config are taken as they come.
+func checkPage(doc *etree.Document, config *Config) []string {
+	root := doc.Root()
+	if root == nil || root.Tag != "document" {
+		return []string{"root element is not document"}
+	}
+	return checkElement(root, root.Tag, config)
+}
+
+func checkElement(element *etree.Element, path string, config *Config) []string {
+	schema, known := pageSchema[element.Tag]
+	switch {
+	case element.Tag == "body":
+		schema = elementSchema{children: slices.Concat(config.BodyElements, generatedBodyElements)}
+	case !known:
+		schema = elementSchema{anyAttrs: true, anyBody: true}
+	}
+
+	var problems []string
+	for _, name := range schema.required {
+		if element.SelectAttr(name) == nil {
+			problems = append(problems, fmt.Sprintf("%s: missing attribute %s", path, name))
+		}
+	}
+	if !schema.anyAttrs {
+		for _, attr := range element.Attr {
+			if !slices.Contains(schema.required, attr.FullKey()) && !slices.Contains(schema.optional, attr.FullKey()) {
+				problems = append(problems, fmt.Sprintf("%s: unexpected attribute %s", path, attr.FullKey()))
+			}
+		}
+	}
+
+	if schema.anyBody {
+		return problems
+	}
+	if !schema.text && len(strings.TrimSpace(element.Text())) > 0 {
+		problems = append(problems, fmt.Sprintf("%s: unexpected text", path))
+	}
+	for _, child := range element.ChildElements() {
+		childPath := path + "/" + child.Tag
+		if !slices.Contains(schema.children, child.Tag) {
+			problems = append(problems, fmt.Sprintf("%s: unexpected element", childPath))
+			continue
+		}
+		problems = append(problems, checkElement(child, childPath, config)...)
+	}
+	return problems
+}
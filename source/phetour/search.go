@@ -0,0 +1,61 @@
+package phetour
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// searchEntry is what search-index.json holds for each post.
+type searchEntry struct {
+	Title string   `json:"title"`
+	URL   string   `json:"url"`
+	Tags  []string `json:"tags"`
+	Date  string   `json:"date,omitempty"`
+	Text  string   `json:"text"`
+}
+
+// buildSearchIndex writes search-index.json next to the generated XML, so
+// that it is copied into the output of every stylesheet for a client-side
+// search to load. Nothing is written unless searchIndex is on.
+func buildSearchIndex(source *Source, taxonomy *Taxonomy, outputPath string, config *Config) error {
+	if !config.SearchIndex {
+		return nil
+	}
+
+	posts := listedPosts(source)
+	slices.SortFunc(posts, comparePostsNewestFirst)
+
+	entries := []searchEntry{}
+	for _, post := range posts {
+		entry := searchEntry{
+			Title: post.Title,
+			URL:   pageHref(post.Dir(config)),
+			Tags:  []string{},
+			Text:  strings.Join(extractBlocks(post.Content.Root().SelectElement("body"), config.SearchIndexCode), "\n\n"),
+		}
+		for _, tag := range taxonomy.TagsOf(post) {
+			entry.Tags = append(entry.Tags, tag.Label)
+		}
+		if !post.Date.IsZero() {
+			entry.Date = post.Date.Format(time.RFC3339)
+		}
+		entries = append(entries, entry)
+	}
+
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(entries); err != nil {
+		return fmt.Errorf("failed to encode search index: %w", err)
+	}
+	if err := writeOutput(filepath.Join(outputPath, "search-index.json"), data.Bytes(), config); err != nil {
+		return fmt.Errorf("failed to write search-index.json: %w", err)
+	}
+	return nil
+}
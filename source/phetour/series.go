@@ -0,0 +1,93 @@
+package phetour
+
+import (
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/beevik/etree"
+)
+
+// seriesParts returns the posts of a series in reading order: by their
+// seriesOrder, parts without one after those with, then by date and key.
+func seriesParts(series Tag, source *Source) []Post {
+	var parts []Post
+	for _, post := range source.Posts {
+		if series.Mentioned(post.Key) {
+			parts = append(parts, post)
+		}
+	}
+	slices.SortFunc(parts, func(a, b Post) int {
+		if (a.SeriesOrder == 0) != (b.SeriesOrder == 0) {
+			if a.SeriesOrder == 0 {
+				return 1
+			}
+			return -1
+		}
+		if c := cmp.Compare(a.SeriesOrder, b.SeriesOrder); c != 0 {
+			return c
+		}
+		if c := feedDate(a).Compare(feedDate(b)); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	return parts
+}
+
+// addSeriesNav records which part of its series post is, and links the
+// parts before and after it, for stylesheets to show as navigation.
+func addSeriesNav(meta *etree.Element, post Post, series Tag, source *Source, config *Config) {
+	parts := seriesParts(series, source)
+	index := slices.IndexFunc(parts, func(part Post) bool { return part.Key == post.Key })
+
+	element := meta.CreateElement("series")
+	element.CreateAttr("value", series.Label)
+	element.CreateAttr("id", FormatKey(series.Key, config))
+	if index < 0 {
+		// An unlisted post names its series but is not one of its parts.
+		return
+	}
+	element.CreateAttr("part", fmt.Sprint(index+1))
+	element.CreateAttr("parts", fmt.Sprint(len(parts)))
+
+	if index > 0 {
+		previous := meta.CreateElement("previous")
+		previous.CreateAttr("href", pageHref(parts[index-1].Dir(config)))
+		previous.CreateAttr("title", parts[index-1].Title)
+	}
+	if index < len(parts)-1 {
+		next := meta.CreateElement("next")
+		next.CreateAttr("href", pageHref(parts[index+1].Dir(config)))
+		next.CreateAttr("title", parts[index+1].Title)
+	}
+}
+
+// buildSeries writes the index page of a series, listing its parts in
+// reading order rather than newest first.
+func buildSeries(series Tag, outputPath string, source *Source, config *Config) error {
+	seriesDir := filepath.Join(outputPath, FormatKey(series.Key, config))
+
+	doc := etree.NewDocument()
+	docRoot := doc.CreateElement("document")
+	meta := docRoot.CreateElement("meta")
+	meta.CreateElement("title").CreateAttr("value", series.Label)
+	addCanonical(meta, pageHref(FormatKey(series.Key, config)), config)
+	addMenu(meta, config)
+
+	body := docRoot.CreateElement("body")
+	body.CreateElement("bold").CreateText(series.Label)
+
+	for i, post := range seriesParts(series, source) {
+		link := body.CreateElement("link")
+		link.CreateAttr("href", pageHref(post.Dir(config)))
+		link.CreateText(fmt.Sprintf("%d. %s", i+1, post.Title))
+	}
+
+	if err := writePage(doc, filepath.Join(seriesDir, "index.xml"), config); err != nil {
+		return fmt.Errorf("failed to write series index.xml: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package phetour
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Serve makes one style's output directory available over HTTP for
+// previewing the site. Directories are answered with their index page
+// whatever its extension, so gemtext and XML output browse as well as HTML.
+func Serve(config *Config, style string, port int) error {
+	root := filepath.Join(config.OutputPath, style)
+	if style == config.PrimaryStyle {
+		root = config.OutputPath
+	}
+	if _, err := os.Stat(root); err != nil {
+		return fmt.Errorf("nothing to serve for style %s: %w", style, err)
+	}
+
+	files := http.FileServer(http.Dir(root))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") {
+			dir := filepath.Join(root, filepath.FromSlash(path.Clean(r.URL.Path)))
+			if index := findIndex(dir); index != "" {
+				http.ServeFile(w, r, index)
+				return
+			}
+		}
+		files.ServeHTTP(w, r)
+	})
+
+	address := fmt.Sprintf("localhost:%d", port)
+	fmt.Printf("serving %s at http://%s/\n", root, address)
+	return http.ListenAndServe(address, handler)
+}
+
+func findIndex(dir string) string {
+	matches, err := filepath.Glob(filepath.Join(dir, "index.*"))
+	if err != nil || len(matches) == 0 {
+		return ""
+	}
+	return matches[0]
+}
@@ -0,0 +1,77 @@
+package phetour
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+// buildSitemap writes sitemap.xml next to the generated XML, listing the
+// home page, the tags index, every post and every tag and author page with
+// the time it last changed. Sitemaps need absolute URLs, so nothing is
+// written without a baseURL.
+func buildSitemap(source *Source, taxonomy *Taxonomy, config *Config, outputPath string) error {
+	if config.BaseURL == "" {
+		return nil
+	}
+	baseURL := strings.TrimSuffix(config.BaseURL, "/")
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	urlset := doc.CreateElement("urlset")
+	urlset.CreateAttr("xmlns", sitemapNamespace)
+
+	addURL := func(path string, modified time.Time) {
+		url := urlset.CreateElement("url")
+		url.CreateElement("loc").CreateText(baseURL + path)
+		if !modified.IsZero() {
+			url.CreateElement("lastmod").CreateText(modified.UTC().Format(time.RFC3339))
+		}
+	}
+
+	posts := listedPosts(source)
+	slices.SortFunc(posts, comparePostsNewestFirst)
+
+	var newest time.Time
+	for _, post := range posts {
+		if lastUpdate(post).After(newest) {
+			newest = lastUpdate(post)
+		}
+	}
+	addURL("/", newest)
+
+	for _, post := range posts {
+		addURL(pageHref(post.Dir(config)), lastUpdate(post))
+	}
+
+	addURL(pageHref(tagsIndexDir), newest)
+
+	for _, tags := range [][]Tag{taxonomy.Tags, taxonomy.Authors, taxonomy.Sections, taxonomy.Series} {
+		for _, tag := range tags {
+			// Pages listing only unlisted posts list nothing.
+			if len(tag.Mentions) == 0 {
+				continue
+			}
+			var modified time.Time
+			for _, post := range posts {
+				if tag.Mentioned(post.Key) && lastUpdate(post).After(modified) {
+					modified = lastUpdate(post)
+				}
+			}
+			addURL(pageHref(FormatKey(tag.Key, config)), modified)
+		}
+	}
+
+	if err := writeDocument(doc, filepath.Join(outputPath, "sitemap.xml"), config); err != nil {
+		return fmt.Errorf("failed to write sitemap.xml: %w", err)
+	}
+	return nil
+}
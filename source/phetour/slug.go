@@ -0,0 +1,46 @@
+package phetour
+
+import (
+	"strings"
+	"unicode"
+)
+
+// armenianLetters transliterates lowercase Armenian letters to ASCII. The
+// digraph ու is handled separately, since it reads as a single u.
+var armenianLetters = map[rune]string{
+	'ա': "a", 'բ': "b", 'գ': "g", 'դ': "d", 'ե': "e", 'զ': "z", 'է': "e",
+	'ը': "y", 'թ': "t", 'ժ': "zh", 'ի': "i", 'լ': "l", 'խ': "kh", 'ծ': "ts",
+	'կ': "k", 'հ': "h", 'ձ': "dz", 'ղ': "gh", 'ճ': "ch", 'մ': "m", 'յ': "y",
+	'ն': "n", 'շ': "sh", 'ո': "o", 'չ': "ch", 'պ': "p", 'ջ': "j", 'ռ': "r",
+	'ս': "s", 'վ': "v", 'տ': "t", 'ր': "r", 'ց': "ts", 'ւ': "v", 'փ': "p",
+	'ք': "k", 'օ': "o", 'ֆ': "f", 'և': "ev",
+}
+
+// slugify turns a title into a slug: lowercase, Armenian transliterated,
+// every run of anything but letters and digits replaced by a single
+// hyphen. Other scripts are kept as they are. The result only depends on
+// the title, so a post keeps its slug for as long as it keeps its title.
+func slugify(title string) string {
+	title = strings.ReplaceAll(strings.ToLower(title), "ու", "u")
+
+	var builder strings.Builder
+	separate := false
+	for _, r := range title {
+		var part string
+		if latin, ok := armenianLetters[r]; ok {
+			part = latin
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			part = string(r)
+		} else {
+			separate = builder.Len() > 0
+			continue
+		}
+
+		if separate {
+			builder.WriteByte('-')
+			separate = false
+		}
+		builder.WriteString(part)
+	}
+	return builder.String()
+}
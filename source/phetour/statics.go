@@ -0,0 +1,222 @@
+package phetour
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staticsWorkers bounds how many static files are copied at once.
+var staticsWorkers = runtime.NumCPU()
+
+// staticCopy is one file of the statics tree to be copied. Kept tells that
+// the previous build copied it too and left it in place, with the hash it
+// had then.
+type staticCopy struct {
+	src  string
+	dst  string
+	kept bool
+	hash string
+}
+
+// copyStatics copies the statics tree into dstPath. Symlinks are followed,
+// so a linked file or directory is copied as its target, and every file
+// keeps the permission bits and modification time of its source. Statics
+// may add files to generated directories but never replace a generated
+// file.
+//
+// kept maps the copies the previous build left in place, see keptStatics,
+// to their hashes in its manifest. A copy whose size and modification time
+// still match its source is not copied again. Entries are deleted from kept
+// as their statics are found, so that what remains are copies of statics
+// removed or ignored since. It returns the paths of all copies.
+func copyStatics(srcPath string, dstPath string, kept map[string]string, config *Config) (map[string]bool, error) {
+	statics := map[string]bool{}
+	if _, err := os.Stat(srcPath); os.IsNotExist(err) {
+		return statics, nil
+	}
+
+	var copies []staticCopy
+	if err := collectStatics(srcPath, dstPath, "", kept, config, map[string]bool{}, &copies); err != nil {
+		return nil, err
+	}
+	for _, job := range copies {
+		statics[job.dst] = true
+	}
+
+	// The order of copies does not matter, so they are spread over a
+	// bounded number of workers and every failure is reported.
+	jobs := make(chan int)
+	errs := make([]error, len(copies))
+	var wg sync.WaitGroup
+	for range min(staticsWorkers, len(copies)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = copyStatic(copies[i])
+			}
+		}()
+	}
+	for i := range copies {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return statics, errors.Join(errs...)
+}
+
+// collectStatics lists the files of srcPath, found at prefix below the
+// statics root, to be copied into dstPath, and creates their directories.
+// Visited holds the resolved paths of the directories being walked, so
+// that a symlink pointing back up the tree fails instead of recursing
+// forever.
+func collectStatics(srcPath string, dstPath string, prefix string, kept map[string]string, config *Config, visited map[string]bool, copies *[]staticCopy) error {
+	ignore := config.Ignore
+	resolved, err := filepath.EvalSymlinks(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", srcPath, err)
+	}
+	if visited[resolved] {
+		return fmt.Errorf("symlink loop at %s", srcPath)
+	}
+	visited[resolved] = true
+	defer delete(visited, resolved)
+
+	return filepath.Walk(resolved, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(resolved, path)
+		if err != nil {
+			return err
+		}
+
+		staticPath := filepath.ToSlash(filepath.Join(prefix, relPath))
+		if relPath != "." && ignore.Matches(staticPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		dstFile := filepath.Join(dstPath, relPath)
+		if err := makeOutputDir(filepath.Dir(dstFile), config); err != nil {
+			return fmt.Errorf("failed to create destination directory: %w", err)
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			target, err := os.Stat(path)
+			if err != nil {
+				return fmt.Errorf("failed to follow symlink %s: %w", path, err)
+			}
+			if target.IsDir() {
+				if ignore.Matches(staticPath, true) {
+					return nil
+				}
+				return collectStatics(path, dstFile, staticPath, kept, config, visited, copies)
+			}
+		}
+
+		hash, isKept := kept[dstFile]
+		delete(kept, dstFile)
+		*copies = append(*copies, staticCopy{src: path, dst: dstFile, kept: isKept, hash: hash})
+		return nil
+	})
+}
+
+// copyStatic copies one static file, unless the previous build's copy is
+// still current. Any other file in its place is generated output.
+func copyStatic(job staticCopy) error {
+	if dstInfo, err := os.Lstat(job.dst); err == nil {
+		if !job.kept {
+			return fmt.Errorf("static file %s collides with generated output %s", job.src, job.dst)
+		}
+		srcInfo, err := os.Stat(job.src)
+		if err != nil {
+			return fmt.Errorf("failed to stat source file: %w", err)
+		}
+		if dstInfo.Size() == srcInfo.Size() && dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+			return nil
+		}
+		// The copy changed since the previous build only if a generated
+		// file was written over it.
+		if hash, err := hashFile(job.dst); err != nil || hash != job.hash {
+			return fmt.Errorf("static file %s collides with generated output %s", job.src, job.dst)
+		}
+	}
+
+	return copyFile(job.src, job.dst)
+}
+
+// keptStatics lists the static copies the previous manifest holds whose
+// static is still there, with their hashes, so that they can be left in
+// place rather than removed and copied again.
+func keptStatics(outputPath string, manifest *Manifest) map[string]string {
+	kept := map[string]string{}
+	if manifest == nil {
+		return kept
+	}
+	for _, file := range manifest.Files {
+		relPath, ok := strings.CutPrefix(file.Path, "xml/")
+		if !ok || !file.Static {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(staticsInputPath, filepath.FromSlash(relPath))); err == nil && !info.IsDir() {
+			kept[filepath.Join(outputPath, filepath.FromSlash(file.Path))] = file.Hash
+		}
+	}
+	return kept
+}
+
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer srcFile.Close()
+
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, srcInfo.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer dstFile.Close()
+
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	// The mode given to OpenFile is masked by the umask and ignored for
+	// files that already exist, so set it explicitly.
+	if err := dstFile.Chmod(srcInfo.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := dstFile.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	// Keeping the modification time lets the next build tell that the
+	// copy is still current without reading it.
+	if err := os.Chtimes(dst, time.Time{}, srcInfo.ModTime()); err != nil {
+		return fmt.Errorf("failed to set file time: %w", err)
+	}
+
+	return nil
+}
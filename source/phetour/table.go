@@ -0,0 +1,113 @@
+package phetour
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// delimiterCellPattern matches one cell of the line below a table's header,
+// its colons telling how the column is aligned.
+var delimiterCellPattern = regexp.MustCompile(`^:?-+:?$`)
+
+// isTableStart reports whether a pipe table starts at line i: a row of
+// cells between pipes, followed by a delimiter row with a cell for each.
+// Anything less stays a paragraph, as it always was.
+func isTableStart(lines []string, i int) bool {
+	if i+1 >= len(lines) || !isTableRow(strings.TrimSpace(lines[i])) {
+		return false
+	}
+	header := splitTableRow(strings.TrimSpace(lines[i]))
+	alignments, ok := parseDelimiterRow(strings.TrimSpace(lines[i+1]))
+	return ok && len(alignments) == len(header)
+}
+
+// isTableRow reports whether line is written as a table row.
+func isTableRow(line string) bool {
+	return strings.HasPrefix(line, "|")
+}
+
+// splitTableRow splits a table row into its cells, trimmed. The pipes at
+// either end are optional, and \| stands for a pipe inside a cell.
+func splitTableRow(line string) []string {
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = strings.TrimSuffix(line, "|")
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// parseDelimiterRow reads the alignment of each column from the line below
+// a table's header: left, center, right, or "" for none.
+func parseDelimiterRow(line string) ([]string, bool) {
+	if !isTableRow(line) {
+		return nil, false
+	}
+	var alignments []string
+	for _, cell := range splitTableRow(line) {
+		if !delimiterCellPattern.MatchString(cell) {
+			return nil, false
+		}
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		switch {
+		case left && right:
+			alignments = append(alignments, "center")
+		case right:
+			alignments = append(alignments, "right")
+		case left:
+			alignments = append(alignments, "left")
+		default:
+			alignments = append(alignments, "")
+		}
+	}
+	return alignments, true
+}
+
+// parseTable reads the pipe table starting at startIdx into a table
+// element: a row marked as the header, then a row for every line that
+// follows it starting with a pipe. Every cell carries the alignment of its
+// column, and rows are cut or padded to the header's number of cells.
+func parseTable(lines []string, startIdx int) (*etree.Element, int) {
+	header := splitTableRow(strings.TrimSpace(lines[startIdx]))
+	alignments, _ := parseDelimiterRow(strings.TrimSpace(lines[startIdx+1]))
+
+	table := etree.NewElement("table")
+	addTableRow(table, header, alignments).CreateAttr("header", "true")
+
+	i := startIdx + 2
+	for i < len(lines) && isTableRow(strings.TrimSpace(lines[i])) {
+		addTableRow(table, splitTableRow(strings.TrimSpace(lines[i])), alignments)
+		i++
+	}
+	return table, i
+}
+
+func addTableRow(table *etree.Element, cells []string, alignments []string) *etree.Element {
+	row := table.CreateElement("row")
+	for n, alignment := range alignments {
+		cell := row.CreateElement("cell")
+		if alignment != "" {
+			cell.CreateAttr("align", alignment)
+		}
+		if n < len(cells) {
+			addInlineText(cell, cells[n])
+		}
+	}
+	return row
+}
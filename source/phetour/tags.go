@@ -0,0 +1,168 @@
+package phetour
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+const (
+	tagsFilePath = "./tags.xml"
+)
+
+// Tag is a tag or an author. Mentions lists the keys of the posts using
+// it, in the order they were found; mentioned holds the same keys for
+// quick lookups.
+type Tag struct {
+	Label     string
+	Key       int
+	Mentions  []int
+	mentioned map[int]bool
+}
+
+// Taxonomy holds everything posts are grouped by. A post may have many
+// tags, but at most one author, one section and one series.
+type Taxonomy struct {
+	Keylock  *Keylock
+	Tags     []Tag
+	Authors  []Tag
+	Sections []Tag
+	Series   []Tag
+}
+
+func NewTaxonomy(keylock *Keylock) *Taxonomy {
+	return &Taxonomy{Keylock: keylock, Tags: []Tag{}, Authors: []Tag{}, Sections: []Tag{}, Series: []Tag{}}
+}
+
+// assure returns the entry of list with the given label, adding it with a
+// key for prefix and label when there is none yet. Tags, authors, sections
+// and series are all kept this way, apart only by their lists and prefixes.
+func (taxonomy *Taxonomy) assure(list *[]Tag, prefix, label string) *Tag {
+	for i := range *list {
+		if (*list)[i].Label == label {
+			return &(*list)[i]
+		}
+	}
+	key := taxonomy.Keylock.AssureKey(prefix + label)
+	*list = append(*list, Tag{
+		Label:     label,
+		Key:       key,
+		Mentions:  []int{},
+		mentioned: map[int]bool{},
+	})
+	return &(*list)[len(*list)-1]
+}
+
+func (taxonomy *Taxonomy) AssureTag(label string) *Tag {
+	return taxonomy.assure(&taxonomy.Tags, "TAG:", label)
+}
+
+func (taxonomy *Taxonomy) AssureAuthor(name string) *Tag {
+	return taxonomy.assure(&taxonomy.Authors, "AUTHOR:", name)
+}
+
+func (taxonomy *Taxonomy) AssureSection(label string) *Tag {
+	return taxonomy.assure(&taxonomy.Sections, "SECTION:", label)
+}
+
+func (taxonomy *Taxonomy) AssureSeries(label string) *Tag {
+	return taxonomy.assure(&taxonomy.Series, "SERIES:", label)
+}
+
+// SeriesOf returns the series of post, if it is part of one.
+func (taxonomy *Taxonomy) SeriesOf(post Post) (Tag, bool) {
+	for _, series := range taxonomy.Series {
+		if series.Key == post.Series {
+			return series, true
+		}
+	}
+	return Tag{}, false
+}
+
+// SectionOf returns the section of post, if it has one.
+func (taxonomy *Taxonomy) SectionOf(post Post) (Tag, bool) {
+	for _, section := range taxonomy.Sections {
+		if section.Key == post.Section {
+			return section, true
+		}
+	}
+	return Tag{}, false
+}
+
+// TagsOf returns the tags of post, in the order the post lists them.
+func (taxonomy *Taxonomy) TagsOf(post Post) []Tag {
+	var tags []Tag
+	for _, key := range post.Tags {
+		for _, tag := range taxonomy.Tags {
+			if tag.Key == key {
+				tags = append(tags, tag)
+				break
+			}
+		}
+	}
+	return tags
+}
+
+func (tag *Tag) AssureMention(document int) {
+	if tag.Mentioned(document) {
+		return
+	}
+	if tag.mentioned == nil {
+		tag.mentioned = map[int]bool{}
+	}
+	tag.mentioned[document] = true
+	tag.Mentions = append(tag.Mentions, document)
+}
+
+// Mentioned reports whether the post with the given key uses the tag.
+func (tag *Tag) Mentioned(document int) bool {
+	return tag.mentioned[document]
+}
+
+// UnusedTags lists the tags that have an ID in the lock file but are not
+// used by any post of this build, in the order of their IDs. Their
+// IDs stay reserved, so they are reported rather than removed.
+func UnusedTags(taxonomy *Taxonomy) []Tag {
+	var unused []Tag
+	for _, key := range taxonomy.Keylock.Keys {
+		label, isTag := strings.CutPrefix(key.Value, "TAG:")
+		if !isTag || slices.ContainsFunc(taxonomy.Tags, func(tag Tag) bool { return tag.Label == label }) {
+			continue
+		}
+		unused = append(unused, Tag{Label: label, Key: key.ID})
+	}
+	return unused
+}
+
+// LoadTagDescriptions reads the descriptions of tags from the tags file,
+// keyed by label. A missing file describes nothing.
+func LoadTagDescriptions() (map[string]string, error) {
+	descriptions := map[string]string{}
+
+	if _, err := os.Stat(tagsFilePath); os.IsNotExist(err) {
+		return descriptions, nil
+	}
+
+	tagsDocument := etree.NewDocument()
+	if err := tagsDocument.ReadFromFile(tagsFilePath); err != nil {
+		return nil, fmt.Errorf("failed reading tags file: %w", err)
+	}
+
+	root := tagsDocument.SelectElement("tags")
+	if root == nil {
+		return nil, fmt.Errorf("no tags element found in tags file")
+	}
+
+	for _, tagElement := range root.SelectElements("tag") {
+		label := tagElement.SelectAttrValue("label", "")
+		if label == "" {
+			return nil, fmt.Errorf("tag element with empty label found in tags file")
+		}
+		descriptions[label] = strings.Join(strings.Fields(tagElement.Text()), " ")
+	}
+
+	return descriptions, nil
+}
@@ -0,0 +1,63 @@
+package phetour
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// proseElements are the body blocks meant to be read: headings, paragraphs,
+// list items, link labels, footnotes and tables.
+var proseElements = []string{"bold", "text", "item", "link", "footnote", "table"}
+
+// extractText returns the readable text of a post body, for excerpts,
+// reading time and search alike. Each prose block becomes one paragraph
+// with its whitespace collapsed, paragraphs are separated by a blank line,
+// and code is left out.
+func extractText(body *etree.Element) string {
+	return strings.Join(extractBlocks(body, false), "\n\n")
+}
+
+// extractBlocks returns the text of each prose block of body, and of each
+// code block as well when withCode is set. Empty blocks are skipped.
+func extractBlocks(body *etree.Element, withCode bool) []string {
+	if body == nil {
+		return nil
+	}
+	var blocks []string
+	for _, elem := range body.ChildElements() {
+		if !slices.Contains(proseElements, elem.Tag) && !(withCode && elem.Tag == "code") {
+			continue
+		}
+		if block := strings.Join(strings.Fields(innerText(elem)), " "); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// inlineElements are the elements a paragraph holds when paragraphs are
+// Markdown, which run on with the text around them.
+var inlineElements = []string{"emphasis", "strong", "code", "link"}
+
+// innerText joins all the text inside element, so that a paragraph broken
+// up by break elements reads as a whole. Inline elements join the text
+// around them as they are; any other element is set apart by a space.
+func innerText(element *etree.Element) string {
+	var builder strings.Builder
+	for _, child := range element.Child {
+		switch child := child.(type) {
+		case *etree.CharData:
+			builder.WriteString(child.Data)
+		case *etree.Element:
+			if slices.Contains(inlineElements, child.Tag) {
+				builder.WriteString(innerText(child))
+			} else if text := innerText(child); text != "" {
+				builder.WriteString(" ")
+				builder.WriteString(text)
+			}
+		}
+	}
+	return builder.String()
+}
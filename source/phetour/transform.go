@@ -0,0 +1,401 @@
+package phetour
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"phetour/source/xslt"
+
+	"github.com/beevik/etree"
+)
+
+// findStylesheets lists the .xsl files directly in stylesInputPath. Each
+// one produces an output directory named after it. Subdirectories hold the
+// stylesheets posts may ask for with their style field.
+func findStylesheets(stylesInputPath string) ([]string, error) {
+	entries, err := os.ReadDir(stylesInputPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read styles directory: %w", err)
+	}
+
+	var xslFiles []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(strings.ToLower(entry.Name()), ".xsl") {
+			xslFiles = append(xslFiles, filepath.Join(stylesInputPath, entry.Name()))
+		}
+	}
+
+	return xslFiles, nil
+}
+
+// overrideStylesheet returns the stylesheet a post's style asks for in
+// place of styleName's, or "" when the style has none for it.
+func overrideStylesheet(style, styleName string) string {
+	xslFile := filepath.Join(stylesInputPath, style, styleName+".xsl")
+	if info, err := os.Stat(xslFile); err != nil || info.IsDir() {
+		return ""
+	}
+	return xslFile
+}
+
+func styleNameOf(xslFile string) string {
+	baseName := filepath.Base(xslFile)
+	return strings.TrimSuffix(baseName, filepath.Ext(baseName))
+}
+
+// applyStylesheets transforms the intermediate XML with every stylesheet.
+// styles maps the pages of posts with a style field, relative to the XML
+// directory, to that style. It returns the paths, relative to the output
+// directory, of every file the stylesheets produced, including the ones
+// kept from the previous build, and the hash of the parameters each
+// stylesheet was applied with. No page is kept from a previous build whose
+// parameters, as previousParams has them, hashed differently.
+func applyStylesheets(xmlOutputPath string, xslFiles []string, styles map[string]string, config *Config, previous map[string]string, previousParams map[string]string) (map[string]bool, map[string]string, error) {
+	params := stylesheetParams(config)
+	hash := paramsHash(params)
+	produced := map[string]bool{}
+	applied := map[string]string{}
+
+	for _, xslFile := range xslFiles {
+		styleName := styleNameOf(xslFile)
+		styleOutputPath := filepath.Join(config.OutputPath, styleName)
+		if styleName == config.PrimaryStyle {
+			styleOutputPath = config.OutputPath
+		}
+		stylePrevious := previous
+		if previousParams[styleName] != hash {
+			stylePrevious = nil
+		}
+		if err := transformXMLDirectory(xmlOutputPath, styleOutputPath, xslFile, styleName, styles, params, config, stylePrevious, produced); err != nil {
+			return nil, nil, fmt.Errorf("failed to transform with stylesheet %s: %w", xslFile, err)
+		}
+		applied[styleName] = hash
+	}
+
+	return produced, applied, nil
+}
+
+func recordOutput(produced map[string]bool, config *Config, dstFile string) error {
+	relPath, err := filepath.Rel(config.OutputPath, dstFile)
+	if err != nil {
+		return err
+	}
+	produced[filepath.ToSlash(relPath)] = true
+	return nil
+}
+
+// upToDate reports whether dstFile, written by the previous build, can be
+// kept as it is: its XML source hashes as it did then, the file itself was
+// not touched since, and neither the stylesheet nor the config changed
+// after it was written. The parameters are compared by applyStylesheets.
+func upToDate(xmlFile, dstFile, xslFile string, config *Config, previous map[string]string) bool {
+	relXML, err := filepath.Rel(config.OutputPath, xmlFile)
+	if err != nil {
+		return false
+	}
+	relDst, err := filepath.Rel(config.OutputPath, dstFile)
+	if err != nil {
+		return false
+	}
+	previousXML, xmlKnown := previous[filepath.ToSlash(relXML)]
+	previousDst, dstKnown := previous[filepath.ToSlash(relDst)]
+	if !xmlKnown || !dstKnown {
+		return false
+	}
+
+	dstInfo, err := os.Stat(dstFile)
+	if err != nil {
+		return false
+	}
+	for _, input := range []string{xslFile, configFilePath} {
+		info, err := os.Stat(input)
+		if err == nil && info.ModTime().After(dstInfo.ModTime()) {
+			return false
+		}
+	}
+
+	if hash, err := hashFile(xmlFile); err != nil || hash != previousXML {
+		return false
+	}
+	if hash, err := hashFile(dstFile); err != nil || hash != previousDst {
+		return false
+	}
+	return true
+}
+
+// stylesheetParams collects the string parameters passed to every
+// transformation. The site title, base URL, build time, highlight theme
+// and preview flag are always available; params from the config file are
+// added on top of them.
+func stylesheetParams(config *Config) map[string]string {
+	params := map[string]string{
+		"siteTitle":      config.SiteTitle,
+		"baseURL":        config.BaseURL,
+		"buildTime":      config.BuildTime.Format(time.RFC3339),
+		"highlightTheme": config.HighlightTheme,
+		"preview":        "",
+	}
+	if config.Preview {
+		params["preview"] = "true"
+	}
+	for name, value := range config.Params {
+		params[name] = value
+	}
+	return params
+}
+
+// paramsHash fingerprints the parameters of a transformation. buildTime
+// is left out: it changes with every build, and a page kept because nothing
+// else changed is meant to keep the time it was built at.
+func paramsHash(params map[string]string) string {
+	hash := sha256.New()
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		if name == "buildTime" {
+			continue
+		}
+		fmt.Fprintf(hash, "%s=%q\n", name, params[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func transformXMLDirectory(srcPath, dstPath, xslFile, styleName string, styles map[string]string, params map[string]string, config *Config, previous map[string]string, produced map[string]bool) error {
+	if err := makeOutputDir(dstPath, config); err != nil {
+		return fmt.Errorf("failed to create style output directory: %w", err)
+	}
+
+	transform, err := newTransform(xslFile, params, config)
+	if err != nil {
+		return err
+	}
+	// Override stylesheets are compiled once, when a page first needs them.
+	transforms := map[string]func(xmlPath, dstPath string) error{xslFile: transform}
+
+	extension := styleExtension(xslFile, styleName, config)
+
+	return filepath.Walk(srcPath, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(srcPath, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return makeOutputDir(filepath.Join(dstPath, relPath), config)
+		}
+
+		dstFile := filepath.Join(dstPath, relPath)
+
+		// Only the generated pages are transformed. Any other file, the
+		// sitemap or an XML static among them, is copied as it is.
+		if filepath.Base(path) != "index.xml" {
+			if err := recordOutput(produced, config, dstFile); err != nil {
+				return err
+			}
+			return copyFile(path, dstFile)
+		}
+
+		if config.PrettyURLs {
+			dstFile = filepath.Join(filepath.Dir(dstFile), "index.html")
+		} else {
+			dstFile = strings.TrimSuffix(dstFile, ".xml") + "." + extension
+		}
+		if err := recordOutput(produced, config, dstFile); err != nil {
+			return err
+		}
+
+		pageXSLFile := xslFile
+		if style, ok := styles[filepath.ToSlash(relPath)]; ok {
+			if override := overrideStylesheet(style, styleName); override != "" {
+				pageXSLFile = override
+			}
+		}
+
+		if !config.Force && upToDate(path, dstFile, pageXSLFile, config, previous) {
+			return nil
+		}
+
+		if err := makeOutputDir(filepath.Dir(dstFile), config); err != nil {
+			return fmt.Errorf("failed to create destination directory: %w", err)
+		}
+
+		pageTransform, ok := transforms[pageXSLFile]
+		if !ok {
+			pageTransform, err = newTransform(pageXSLFile, params, config)
+			if err != nil {
+				return fmt.Errorf("failed to load stylesheet %s: %w", pageXSLFile, err)
+			}
+			transforms[pageXSLFile] = pageTransform
+		}
+		return pageTransform(path, dstFile)
+	})
+}
+
+// styleExtension picks the file extension of a stylesheet's output: the
+// one configured for the style, "html" when the stylesheet declares the
+// html output method, and the stylesheet's own name otherwise.
+func styleExtension(xslFile, styleName string, config *Config) string {
+	if extension := config.Styles[styleName].Extension; extension != "" {
+		return extension
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(xslFile); err == nil && doc.Root() != nil {
+		for _, element := range doc.Root().ChildElements() {
+			if element.Tag == "output" && element.SelectAttrValue("method", "") == "html" {
+				return "html"
+			}
+		}
+	}
+
+	return styleName
+}
+
+// newTransform prepares the configured XSLT processor for one stylesheet
+// and returns a function applying it to a single XML file.
+func newTransform(xslPath string, params map[string]string, config *Config) (func(xmlPath, dstPath string) error, error) {
+	switch config.XSLTProcessor {
+	case "native":
+		stylesheet, err := xslt.Load(xslPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile stylesheet: %w", err)
+		}
+		return func(xmlPath, dstPath string) error {
+			return transformNative(xmlPath, dstPath, stylesheet, params, config)
+		}, nil
+
+	case "external":
+		command := config.XSLTCommand
+		if command == "" {
+			var err error
+			if command, err = findExternalProcessor(); err != nil {
+				return nil, err
+			}
+		} else if err := checkXSLTCommand(command); err != nil {
+			return nil, err
+		}
+		program, template := splitXSLTCommand(command)
+		path, err := exec.LookPath(program)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find XSLT processor: %w", err)
+		}
+		return func(xmlPath, dstPath string) error {
+			args := expandXSLTCommand(program, template, xmlPath, dstPath, xslPath, params)
+			if err := transformExternal(path, args, xmlPath, config); err != nil {
+				return err
+			}
+			// The processor creates the file with whatever mode it likes.
+			return os.Chmod(dstPath, config.FileMode)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown XSLT processor '%s'", config.XSLTProcessor)
+}
+
+func transformNative(xmlPath, dstPath string, stylesheet *xslt.Stylesheet, params map[string]string, config *Config) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(xmlPath); err != nil {
+		return fmt.Errorf("failed to read %s: %w", xmlPath, err)
+	}
+
+	output, err := stylesheet.Transform(doc, params)
+	if err != nil {
+		return fmt.Errorf("XSLT transformation of %s failed: %w", xmlPath, err)
+	}
+
+	return writeOutput(dstPath, output, config)
+}
+
+// externalProcessors are the command templates tried, in order, when no
+// xsltCommand is configured. {in}, {out} and {xsl} stand for the page, its
+// output and the stylesheet; {params} expands to the stylesheet parameters
+// in the processor's own form.
+var externalProcessors = []string{
+	"xsltproc -o {out} {params} {xsl} {in}",
+	"msxsl.exe {in} {xsl} -o {out} {params}",
+	"msxsl {in} {xsl} -o {out} {params}",
+}
+
+func findExternalProcessor() (string, error) {
+	for _, command := range externalProcessors {
+		program, _ := splitXSLTCommand(command)
+		if _, err := exec.LookPath(program); err == nil {
+			return command, nil
+		}
+	}
+	return "", fmt.Errorf("no XSLT processor found: install xsltproc or msxsl.exe, set xsltCommand, or set xsltProcessor to native")
+}
+
+// checkXSLTCommand rejects a configured command that could not name both
+// its input files and its output.
+func checkXSLTCommand(command string) error {
+	if len(strings.Fields(command)) < 2 {
+		return fmt.Errorf("xsltCommand must name a program and its arguments")
+	}
+	for _, placeholder := range []string{"{in}", "{out}", "{xsl}"} {
+		if !strings.Contains(command, placeholder) {
+			return fmt.Errorf("xsltCommand is missing the %s placeholder", placeholder)
+		}
+	}
+	return nil
+}
+
+func splitXSLTCommand(command string) (string, []string) {
+	fields := strings.Fields(command)
+	return fields[0], fields[1:]
+}
+
+// expandXSLTCommand fills in the placeholders of a command template. A
+// {params} argument becomes one argument per parameter: --stringparam
+// triples for xsltproc, name=value pairs for everything else, which is what
+// msxsl, Saxon and most other processors accept.
+func expandXSLTCommand(program string, template []string, xmlPath, dstPath, xslPath string, params map[string]string) []string {
+	replacer := strings.NewReplacer("{in}", xmlPath, "{out}", dstPath, "{xsl}", xslPath)
+	stringparam := strings.TrimSuffix(filepath.Base(program), ".exe") == "xsltproc"
+
+	var args []string
+	for _, arg := range template {
+		if arg != "{params}" {
+			args = append(args, replacer.Replace(arg))
+			continue
+		}
+		for _, name := range slices.Sorted(maps.Keys(params)) {
+			if stringparam {
+				args = append(args, "--stringparam", name, params[name])
+			} else {
+				args = append(args, name+"="+params[name])
+			}
+		}
+	}
+	return args
+}
+
+func transformExternal(processor string, args []string, xmlPath string, config *Config) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(processor, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("XSLT transformation of %s failed: %w: %s", xmlPath, err, strings.TrimSpace(stderr.String()))
+	}
+
+	// The processor succeeded, so anything it had to say is a warning.
+	if message := strings.TrimSpace(stderr.String()); message != "" {
+		return warn(config, []string{fmt.Sprintf("%s: %s", xmlPath, message)})
+	}
+	return nil
+}
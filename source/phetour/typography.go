@@ -0,0 +1,101 @@
+package phetour
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/beevik/etree"
+)
+
+// smartenPost gives the title and the prose of a post typographic quotes,
+// dashes and ellipses, as pandoc's smart extension does. Code, raw HTML,
+// links and attributes are left as written, since a link label is often
+// the URL itself.
+func smartenPost(document *etree.Document) {
+	if title := document.FindElement("/document/meta/title"); title != nil {
+		smart, _ := smartenText(title.SelectAttrValue("value", ""), 0)
+		title.CreateAttr("value", smart)
+	}
+
+	body := document.FindElement("/document/body")
+	if body == nil {
+		return
+	}
+	for _, elem := range body.ChildElements() {
+		if slices.Contains(proseElements, elem.Tag) && elem.Tag != "link" {
+			smartenElement(elem, 0)
+		}
+	}
+}
+
+// smartenElement smartens the text below element, which follows prev, and
+// returns the last character of it, so that a quote right after a break or
+// a footnote reference still knows what came before.
+func smartenElement(element *etree.Element, prev rune) rune {
+	for _, child := range element.Child {
+		switch child := child.(type) {
+		case *etree.CharData:
+			child.Data, prev = smartenText(child.Data, prev)
+		case *etree.Element:
+			if child.Tag == "code" || child.Tag == "link" {
+				prev = 'x'
+				continue
+			}
+			switch child.Tag {
+			case "break":
+				prev = ' '
+				continue
+			case "row", "cell":
+				// Each cell of a table starts afresh.
+				smartenElement(child, 0)
+				prev = ' '
+				continue
+			}
+			prev = smartenElement(child, prev)
+		}
+	}
+	return prev
+}
+
+// smartenText returns text with --- as an em dash, -- as an en dash, ...
+// as an ellipsis and straight quotes turned into opening or closing ones.
+// A quote opens at the start of the text or after a space or an opening
+// bracket, and closes anywhere else, so an apostrophe is a closing single
+// quote. prev is the character before text, 0 for none.
+func smartenText(text string, prev rune) (string, rune) {
+	var builder strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '-' && i+2 < len(runes) && runes[i+1] == '-' && runes[i+2] == '-':
+			r = '—'
+			i += 2
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			r = '–'
+			i++
+		case r == '.' && i+2 < len(runes) && runes[i+1] == '.' && runes[i+2] == '.':
+			r = '…'
+			i += 2
+		case r == '"':
+			r = '”'
+			if opensQuote(prev) {
+				r = '“'
+			}
+		case r == '\'':
+			r = '’'
+			if opensQuote(prev) {
+				r = '‘'
+			}
+		}
+		builder.WriteRune(r)
+		prev = r
+	}
+	return builder.String(), prev
+}
+
+// opensQuote reports whether a quote after prev opens rather than closes.
+func opensQuote(prev rune) bool {
+	return prev == 0 || unicode.IsSpace(prev) || strings.ContainsRune("([{—–“‘", prev)
+}
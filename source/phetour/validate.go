@@ -0,0 +1,131 @@
+package phetour
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Validate looks for mistakes in the source that do not stop a build but
+// are probably not what the author meant, and returns one warning for each.
+func Validate(source *Source, taxonomy *Taxonomy) []string {
+	var warnings []string
+
+	titles := map[string][]string{}
+	var titleOrder []string
+	for _, post := range source.Posts {
+		title := normalizeLabel(post.Title)
+		if _, seen := titles[title]; !seen {
+			titleOrder = append(titleOrder, title)
+		}
+		titles[title] = append(titles[title], post.Name)
+	}
+	for _, title := range titleOrder {
+		if names := titles[title]; len(names) > 1 {
+			warnings = append(warnings, fmt.Sprintf("posts %s share the title '%s'", strings.Join(names, ", "), title))
+		}
+	}
+
+	labels := map[string][]string{}
+	var labelOrder []string
+	for _, tag := range taxonomy.Tags {
+		label := normalizeLabel(tag.Label)
+		if _, seen := labels[label]; !seen {
+			labelOrder = append(labelOrder, label)
+		}
+		labels[label] = append(labels[label], "'"+tag.Label+"'")
+	}
+	for _, label := range labelOrder {
+		if variants := labels[label]; len(variants) > 1 {
+			warnings = append(warnings, fmt.Sprintf("tags %s differ only in case", strings.Join(variants, ", ")))
+		}
+	}
+
+	// A tag used only once that looks like a more common one is most likely
+	// a typo, which would otherwise get an ID and a page of its own.
+	for _, tag := range taxonomy.Tags {
+		if len(tag.Mentions) != 1 {
+			continue
+		}
+		for _, other := range taxonomy.Tags {
+			if len(other.Mentions) > 1 && resembles(tag.Label, other.Label) {
+				warnings = append(warnings, fmt.Sprintf("tag '%s' is used once and resembles '%s', used %d times", tag.Label, other.Label, len(other.Mentions)))
+				break
+			}
+		}
+	}
+
+	// Two parts claiming the same number leave their order to their dates.
+	for _, series := range taxonomy.Series {
+		claimed := map[int]string{}
+		for _, post := range seriesParts(series, source) {
+			if post.SeriesOrder == 0 {
+				continue
+			}
+			if other, taken := claimed[post.SeriesOrder]; taken {
+				warnings = append(warnings, fmt.Sprintf("posts %s and %s are both part %d of series '%s'", other, post.Name, post.SeriesOrder, series.Label))
+			}
+			claimed[post.SeriesOrder] = post.Name
+		}
+	}
+
+	for _, post := range source.Posts {
+		if !post.Updated.IsZero() && post.Updated.Before(post.Date) {
+			warnings = append(warnings, fmt.Sprintf("post %s was updated before it was published", post.Name))
+		}
+	}
+
+	return warnings
+}
+
+// resembles reports whether two labels are a small typo apart: one edit for
+// short labels, two for labels of six letters or more.
+func resembles(a, b string) bool {
+	x, y := []rune(normalizeLabel(a)), []rune(normalizeLabel(b))
+	if string(x) == string(y) {
+		return false
+	}
+	limit := 1
+	if min(len(x), len(y)) >= 6 {
+		limit = 2
+	}
+	return editDistance(x, y) <= limit
+}
+
+// editDistance counts the insertions, deletions and substitutions that
+// turn a into b.
+func editDistance(a, b []rune) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			diagonal, row[j] = row[j], min(row[j]+1, row[j-1]+1, diagonal+cost)
+		}
+	}
+	return row[len(b)]
+}
+
+// normalizeLabel folds case and collapses whitespace, so that labels a
+// reader would take for the same one compare equal.
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// warn prints warnings to stderr. In strict mode they also fail the build.
+func warn(config *Config, warnings []string) error {
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "phetour: warning: %s\n", warning)
+	}
+	if config.Strict && len(warnings) > 0 {
+		return fmt.Errorf("%d warnings in strict mode", len(warnings))
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+package xslt
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type functionExpr struct {
+	name string
+	args []expr
+}
+
+func (e *functionExpr) eval(c *context) any {
+	return functions[e.name](c, e.args)
+}
+
+type function func(c *context, args []expr) any
+
+var functions map[string]function
+
+func init() {
+	functions = map[string]function{
+		"last": func(c *context, args []expr) any {
+			return float64(c.size)
+		},
+		"position": func(c *context, args []expr) any {
+			return float64(c.position)
+		},
+		"count": func(c *context, args []expr) any {
+			return float64(len(toNodeSet(arg(c, args, 0))))
+		},
+		"current": func(c *context, args []expr) any {
+			return []*node{c.current}
+		},
+		"generate-id": func(c *context, args []expr) any {
+			n := optionalNode(c, args)
+			if n == nil {
+				return ""
+			}
+			return "id" + strconv.Itoa(n.order)
+		},
+		"name": func(c *context, args []expr) any {
+			if n := optionalNode(c, args); n != nil {
+				return n.name
+			}
+			return ""
+		},
+		"local-name": func(c *context, args []expr) any {
+			if n := optionalNode(c, args); n != nil {
+				return n.localName()
+			}
+			return ""
+		},
+		"namespace-uri": func(c *context, args []expr) any {
+			return ""
+		},
+		"string": func(c *context, args []expr) any {
+			return optionalString(c, args)
+		},
+		"concat": func(c *context, args []expr) any {
+			var builder strings.Builder
+			for i := range args {
+				builder.WriteString(toString(arg(c, args, i)))
+			}
+			return builder.String()
+		},
+		"starts-with": func(c *context, args []expr) any {
+			return strings.HasPrefix(toString(arg(c, args, 0)), toString(arg(c, args, 1)))
+		},
+		"contains": func(c *context, args []expr) any {
+			return strings.Contains(toString(arg(c, args, 0)), toString(arg(c, args, 1)))
+		},
+		"substring-before": func(c *context, args []expr) any {
+			before, _, found := strings.Cut(toString(arg(c, args, 0)), toString(arg(c, args, 1)))
+			if !found {
+				return ""
+			}
+			return before
+		},
+		"substring-after": func(c *context, args []expr) any {
+			_, after, _ := strings.Cut(toString(arg(c, args, 0)), toString(arg(c, args, 1)))
+			return after
+		},
+		"substring": func(c *context, args []expr) any {
+			runes := []rune(toString(arg(c, args, 0)))
+			start := xpathRound(toNumber(arg(c, args, 1)))
+			end := math.Inf(1)
+			if len(args) > 2 {
+				end = start + xpathRound(toNumber(arg(c, args, 2)))
+			}
+			var builder strings.Builder
+			for i, r := range runes {
+				position := float64(i + 1)
+				if position >= start && position < end {
+					builder.WriteRune(r)
+				}
+			}
+			return builder.String()
+		},
+		"string-length": func(c *context, args []expr) any {
+			return float64(utf8.RuneCountInString(optionalString(c, args)))
+		},
+		"normalize-space": func(c *context, args []expr) any {
+			return strings.Join(strings.Fields(optionalString(c, args)), " ")
+		},
+		"translate": func(c *context, args []expr) any {
+			from := []rune(toString(arg(c, args, 1)))
+			to := []rune(toString(arg(c, args, 2)))
+			return strings.Map(func(r rune) rune {
+				for i, f := range from {
+					if f == r {
+						if i < len(to) {
+							return to[i]
+						}
+						return -1
+					}
+				}
+				return r
+			}, toString(arg(c, args, 0)))
+		},
+		"boolean": func(c *context, args []expr) any {
+			return toBoolean(arg(c, args, 0))
+		},
+		"not": func(c *context, args []expr) any {
+			return !toBoolean(arg(c, args, 0))
+		},
+		"true": func(c *context, args []expr) any {
+			return true
+		},
+		"false": func(c *context, args []expr) any {
+			return false
+		},
+		"number": func(c *context, args []expr) any {
+			if len(args) == 0 {
+				return toNumber([]*node{c.node})
+			}
+			return toNumber(arg(c, args, 0))
+		},
+		"sum": func(c *context, args []expr) any {
+			total := 0.0
+			for _, n := range toNodeSet(arg(c, args, 0)) {
+				total += stringToNumber(n.stringValue())
+			}
+			return total
+		},
+		"floor": func(c *context, args []expr) any {
+			return math.Floor(toNumber(arg(c, args, 0)))
+		},
+		"ceiling": func(c *context, args []expr) any {
+			return math.Ceil(toNumber(arg(c, args, 0)))
+		},
+		"round": func(c *context, args []expr) any {
+			return xpathRound(toNumber(arg(c, args, 0)))
+		},
+		"node-set": func(c *context, args []expr) any {
+			return toNodeSet(arg(c, args, 0))
+		},
+	}
+}
+
+func arg(c *context, args []expr, index int) any {
+	if index >= len(args) {
+		fail("missing function argument %d", index+1)
+	}
+	return args[index].eval(c)
+}
+
+func optionalNode(c *context, args []expr) *node {
+	if len(args) == 0 {
+		return c.node
+	}
+	nodes := toNodeSet(arg(c, args, 0))
+	if len(nodes) == 0 {
+		return nil
+	}
+	return nodes[0]
+}
+
+func optionalString(c *context, args []expr) string {
+	if len(args) == 0 {
+		return c.node.stringValue()
+	}
+	return toString(arg(c, args, 0))
+}
+
+func xpathRound(number float64) float64 {
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return number
+	}
+	return math.Floor(number + 0.5)
+}
+
+func toNodeSet(value any) []*node {
+	nodes, ok := value.([]*node)
+	if !ok {
+		fail("expression does not evaluate to a node-set")
+	}
+	return nodes
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return numberToString(v)
+	case []*node:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].stringValue()
+	}
+	return ""
+}
+
+func numberToString(number float64) string {
+	switch {
+	case math.IsNaN(number):
+		return "NaN"
+	case math.IsInf(number, 1):
+		return "Infinity"
+	case math.IsInf(number, -1):
+		return "-Infinity"
+	case number == 0:
+		return "0"
+	}
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+func toNumber(value any) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	}
+	return stringToNumber(toString(value))
+}
+
+func stringToNumber(text string) float64 {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.ContainsAny(text, "eE+xX") || strings.Contains(text, "Inf") {
+		return math.NaN()
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return number
+}
+
+func toBoolean(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case []*node:
+		return len(v) > 0
+	}
+	return false
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *binaryExpr) eval(c *context) any {
+	switch e.op {
+	case "or":
+		return toBoolean(e.left.eval(c)) || toBoolean(e.right.eval(c))
+	case "and":
+		return toBoolean(e.left.eval(c)) && toBoolean(e.right.eval(c))
+	case "+":
+		return toNumber(e.left.eval(c)) + toNumber(e.right.eval(c))
+	case "-":
+		return toNumber(e.left.eval(c)) - toNumber(e.right.eval(c))
+	case "*":
+		return toNumber(e.left.eval(c)) * toNumber(e.right.eval(c))
+	case "div":
+		return toNumber(e.left.eval(c)) / toNumber(e.right.eval(c))
+	case "mod":
+		return math.Mod(toNumber(e.left.eval(c)), toNumber(e.right.eval(c)))
+	}
+	return compare(e.op, e.left.eval(c), e.right.eval(c))
+}
+
+// compare implements the XPath 1.0 comparison rules, under which a node-set
+// compares true when any of its nodes satisfies the comparison.
+func compare(op string, left, right any) bool {
+	leftNodes, leftIsNodes := left.([]*node)
+	rightNodes, rightIsNodes := right.([]*node)
+
+	switch {
+	case leftIsNodes && rightIsNodes:
+		for _, l := range leftNodes {
+			for _, r := range rightNodes {
+				if compareAtomic(op, l.stringValue(), r.stringValue()) {
+					return true
+				}
+			}
+		}
+		return false
+	case leftIsNodes:
+		if b, ok := right.(bool); ok {
+			return compareAtomic(op, len(leftNodes) > 0, b)
+		}
+		for _, l := range leftNodes {
+			if compareAtomic(op, nodeValueLike(l, right), right) {
+				return true
+			}
+		}
+		return false
+	case rightIsNodes:
+		if b, ok := left.(bool); ok {
+			return compareAtomic(op, b, len(rightNodes) > 0)
+		}
+		for _, r := range rightNodes {
+			if compareAtomic(op, left, nodeValueLike(r, left)) {
+				return true
+			}
+		}
+		return false
+	}
+	return compareAtomic(op, left, right)
+}
+
+func nodeValueLike(n *node, other any) any {
+	if _, ok := other.(float64); ok {
+		return stringToNumber(n.stringValue())
+	}
+	return n.stringValue()
+}
+
+func compareAtomic(op string, left, right any) bool {
+	if op == "=" || op == "!=" {
+		var equal bool
+		_, leftBool := left.(bool)
+		_, rightBool := right.(bool)
+		_, leftNumber := left.(float64)
+		_, rightNumber := right.(float64)
+		switch {
+		case leftBool || rightBool:
+			equal = toBoolean(left) == toBoolean(right)
+		case leftNumber || rightNumber:
+			equal = toNumber(left) == toNumber(right)
+		default:
+			equal = toString(left) == toString(right)
+		}
+		return equal == (op == "=")
+	}
+
+	l, r := toNumber(left), toNumber(right)
+	switch op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return false
+}
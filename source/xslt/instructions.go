@@ -0,0 +1,565 @@
+package xslt
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+type instruction interface {
+	execute(t *transformer, c *context, out *node)
+}
+
+func compileBody(parent *etree.Element) ([]instruction, error) {
+	var body []instruction
+	for _, token := range parent.Child {
+		switch child := token.(type) {
+		case *etree.CharData:
+			if strings.TrimSpace(child.Data) != "" {
+				body = append(body, &textInstruction{text: child.Data})
+			}
+		case *etree.Element:
+			instr, err := compileInstruction(child)
+			if err != nil {
+				return nil, err
+			}
+			if instr != nil {
+				body = append(body, instr)
+			}
+		}
+	}
+	return body, nil
+}
+
+func compileInstruction(element *etree.Element) (instruction, error) {
+	if element.NamespaceURI() != xslNamespace {
+		return compileLiteralElement(element)
+	}
+
+	switch element.Tag {
+	case "text":
+		return &textInstruction{
+			text: element.Text(),
+			raw:  element.SelectAttrValue("disable-output-escaping", "no") == "yes",
+		}, nil
+
+	case "value-of":
+		selectExpr, err := requiredXPath(element, "select")
+		if err != nil {
+			return nil, err
+		}
+		return &valueOf{
+			selectExpr: selectExpr,
+			raw:        element.SelectAttrValue("disable-output-escaping", "no") == "yes",
+		}, nil
+
+	case "apply-templates":
+		instr := &applyTemplates{mode: element.SelectAttrValue("mode", "")}
+		if selectAttr := element.SelectAttr("select"); selectAttr != nil {
+			selectExpr, err := compileXPath(selectAttr.Value)
+			if err != nil {
+				return nil, err
+			}
+			instr.selectExpr = selectExpr
+		}
+		var err error
+		instr.params, instr.sorts, err = compileArguments(element)
+		return instr, err
+
+	case "call-template":
+		instr := &callTemplate{name: element.SelectAttrValue("name", "")}
+		var err error
+		instr.params, _, err = compileArguments(element)
+		return instr, err
+
+	case "if":
+		test, err := requiredXPath(element, "test")
+		if err != nil {
+			return nil, err
+		}
+		body, err := compileBody(element)
+		return &ifInstruction{test: test, body: body}, err
+
+	case "choose":
+		instr := &choose{}
+		for _, child := range element.ChildElements() {
+			switch child.Tag {
+			case "when":
+				test, err := requiredXPath(child, "test")
+				if err != nil {
+					return nil, err
+				}
+				body, err := compileBody(child)
+				if err != nil {
+					return nil, err
+				}
+				instr.whens = append(instr.whens, &ifInstruction{test: test, body: body})
+			case "otherwise":
+				body, err := compileBody(child)
+				if err != nil {
+					return nil, err
+				}
+				instr.otherwise = body
+			}
+		}
+		return instr, nil
+
+	case "for-each":
+		selectExpr, err := requiredXPath(element, "select")
+		if err != nil {
+			return nil, err
+		}
+		instr := &forEach{selectExpr: selectExpr}
+		var rest etree.Element
+		for _, token := range element.Child {
+			if child, ok := token.(*etree.Element); ok && child.NamespaceURI() == xslNamespace && child.Tag == "sort" {
+				sort, err := compileSort(child)
+				if err != nil {
+					return nil, err
+				}
+				instr.sorts = append(instr.sorts, sort)
+				continue
+			}
+			rest.Child = append(rest.Child, token)
+		}
+		instr.body, err = compileBody(&rest)
+		return instr, err
+
+	case "variable":
+		return compileVariable(element)
+
+	case "attribute", "element":
+		name, err := compileAVT(element.SelectAttrValue("name", ""))
+		if err != nil {
+			return nil, err
+		}
+		body, err := compileBody(element)
+		if element.Tag == "attribute" {
+			return &attribute{name: name, body: body}, err
+		}
+		return &literalElement{computedName: name, body: body}, err
+
+	case "copy":
+		body, err := compileBody(element)
+		return &copyInstruction{body: body}, err
+
+	case "copy-of":
+		selectExpr, err := requiredXPath(element, "select")
+		return &copyOf{selectExpr: selectExpr}, err
+
+	case "comment":
+		body, err := compileBody(element)
+		return &comment{body: body}, err
+
+	case "message":
+		body, err := compileBody(element)
+		return &message{body: body, terminate: element.SelectAttrValue("terminate", "no") == "yes"}, err
+
+	case "fallback":
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported instruction xsl:%s", element.Tag)
+}
+
+func requiredXPath(element *etree.Element, name string) (expr, error) {
+	attr := element.SelectAttr(name)
+	if attr == nil {
+		return nil, fmt.Errorf("xsl:%s requires a %s attribute", element.Tag, name)
+	}
+	return compileXPath(attr.Value)
+}
+
+func compileArguments(element *etree.Element) ([]*variable, []*sortKey, error) {
+	var params []*variable
+	var sorts []*sortKey
+	for _, child := range element.ChildElements() {
+		switch child.Tag {
+		case "with-param":
+			param, err := compileVariable(child)
+			if err != nil {
+				return nil, nil, err
+			}
+			params = append(params, param)
+		case "sort":
+			sort, err := compileSort(child)
+			if err != nil {
+				return nil, nil, err
+			}
+			sorts = append(sorts, sort)
+		}
+	}
+	return params, sorts, nil
+}
+
+// avt is a compiled attribute value template: literal text interleaved
+// with {expression} parts.
+type avt []any
+
+func compileAVT(source string) (avt, error) {
+	var parts avt
+	var literal strings.Builder
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case (c == '{' || c == '}') && i+1 < len(source) && source[i+1] == c:
+			literal.WriteByte(c)
+			i++
+		case c == '{':
+			end := strings.IndexByte(source[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated attribute value template %q", source)
+			}
+			compiled, err := compileXPath(source[i+1 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			if literal.Len() > 0 {
+				parts = append(parts, literal.String())
+				literal.Reset()
+			}
+			parts = append(parts, compiled)
+			i += end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	if literal.Len() > 0 {
+		parts = append(parts, literal.String())
+	}
+	return parts, nil
+}
+
+func (a avt) eval(c *context) string {
+	var builder strings.Builder
+	for _, part := range a {
+		if e, ok := part.(expr); ok {
+			builder.WriteString(toString(e.eval(c)))
+		} else {
+			builder.WriteString(part.(string))
+		}
+	}
+	return builder.String()
+}
+
+type textInstruction struct {
+	text string
+	raw  bool
+}
+
+func (i *textInstruction) execute(t *transformer, c *context, out *node) {
+	t.tree.appendText(out, i.text, i.raw)
+}
+
+type valueOf struct {
+	selectExpr expr
+	raw        bool
+}
+
+func (i *valueOf) execute(t *transformer, c *context, out *node) {
+	t.tree.appendText(out, toString(i.selectExpr.eval(c)), i.raw)
+}
+
+type applyTemplates struct {
+	selectExpr expr
+	mode       string
+	params     []*variable
+	sorts      []*sortKey
+}
+
+func (i *applyTemplates) execute(t *transformer, c *context, out *node) {
+	nodes := c.node.children
+	if i.selectExpr != nil {
+		nodes = toNodeSet(i.selectExpr.eval(c))
+	}
+	nodes = sortByKeys(c, nodes, i.sorts)
+	t.applyTemplates(c, nodes, i.mode, t.evalParams(c, i.params), out)
+}
+
+type callTemplate struct {
+	name   string
+	params []*variable
+}
+
+func (i *callTemplate) execute(t *transformer, c *context, out *node) {
+	tmpl, ok := t.sheet.named[i.name]
+	if !ok {
+		fail("no template named %q", i.name)
+	}
+
+	t.depth++
+	defer func() { t.depth-- }()
+	if t.depth > maxDepth {
+		fail("template recursion deeper than %d levels", maxDepth)
+	}
+
+	inner := *c
+	t.invoke(&inner, tmpl, t.evalParams(c, i.params), out)
+}
+
+type ifInstruction struct {
+	test expr
+	body []instruction
+}
+
+func (i *ifInstruction) execute(t *transformer, c *context, out *node) {
+	if toBoolean(i.test.eval(c)) {
+		t.execute(c, i.body, out)
+	}
+}
+
+type choose struct {
+	whens     []*ifInstruction
+	otherwise []instruction
+}
+
+func (i *choose) execute(t *transformer, c *context, out *node) {
+	for _, when := range i.whens {
+		if toBoolean(when.test.eval(c)) {
+			t.execute(c, when.body, out)
+			return
+		}
+	}
+	t.execute(c, i.otherwise, out)
+}
+
+type forEach struct {
+	selectExpr expr
+	sorts      []*sortKey
+	body       []instruction
+}
+
+func (i *forEach) execute(t *transformer, c *context, out *node) {
+	nodes := sortByKeys(c, toNodeSet(i.selectExpr.eval(c)), i.sorts)
+	for index, n := range nodes {
+		inner := *c
+		inner.node = n
+		inner.current = n
+		inner.position = index + 1
+		inner.size = len(nodes)
+		t.execute(&inner, i.body, out)
+	}
+}
+
+type literalElement struct {
+	name         string
+	computedName avt
+	attrs        []literalAttr
+	body         []instruction
+}
+
+type literalAttr struct {
+	name  string
+	value avt
+}
+
+func compileLiteralElement(element *etree.Element) (instruction, error) {
+	instr := &literalElement{name: element.FullTag()}
+	for _, attr := range element.Attr {
+		if attr.Space == "xmlns" || attr.NamespaceURI() == xslNamespace {
+			continue
+		}
+		if attr.Space == "" && attr.Key == "xmlns" && attr.Value == xslNamespace {
+			continue
+		}
+		value, err := compileAVT(attr.Value)
+		if err != nil {
+			return nil, err
+		}
+		instr.attrs = append(instr.attrs, literalAttr{name: attr.FullKey(), value: value})
+	}
+
+	body, err := compileBody(element)
+	instr.body = body
+	return instr, err
+}
+
+func (i *literalElement) execute(t *transformer, c *context, out *node) {
+	name := i.name
+	if i.computedName != nil {
+		name = i.computedName.eval(c)
+	}
+
+	element := t.tree.appendChild(out, elementNode, name, "")
+	for _, attr := range i.attrs {
+		t.tree.setAttr(element, attr.name, attr.value.eval(c))
+	}
+	t.execute(c, i.body, element)
+}
+
+type attribute struct {
+	name avt
+	body []instruction
+}
+
+func (i *attribute) execute(t *transformer, c *context, out *node) {
+	if out.kind != elementNode {
+		return
+	}
+	fragment := t.tree.newNode(rootNode, "", "")
+	t.execute(c, i.body, fragment)
+	t.tree.setAttr(out, i.name.eval(c), fragment.stringValue())
+}
+
+type copyInstruction struct {
+	body []instruction
+}
+
+func (i *copyInstruction) execute(t *transformer, c *context, out *node) {
+	switch n := c.node; n.kind {
+	case elementNode:
+		element := t.tree.appendChild(out, elementNode, n.name, "")
+		t.execute(c, i.body, element)
+	case rootNode:
+		t.execute(c, i.body, out)
+	case attributeNode:
+		if out.kind == elementNode {
+			t.tree.setAttr(out, n.name, n.value)
+		}
+	case textNode:
+		t.tree.appendText(out, n.value, n.raw)
+	case commentNode:
+		t.tree.appendChild(out, commentNode, "", n.value)
+	}
+}
+
+type copyOf struct {
+	selectExpr expr
+}
+
+func (i *copyOf) execute(t *transformer, c *context, out *node) {
+	value := i.selectExpr.eval(c)
+	nodes, ok := value.([]*node)
+	if !ok {
+		t.tree.appendText(out, toString(value), false)
+		return
+	}
+	for _, n := range nodes {
+		t.deepCopy(n, out)
+	}
+}
+
+func (t *transformer) deepCopy(n *node, out *node) {
+	switch n.kind {
+	case rootNode:
+		for _, child := range n.children {
+			t.deepCopy(child, out)
+		}
+	case elementNode:
+		element := t.tree.appendChild(out, elementNode, n.name, "")
+		for _, attr := range n.attrs {
+			t.tree.setAttr(element, attr.name, attr.value)
+		}
+		for _, child := range n.children {
+			t.deepCopy(child, element)
+		}
+	case attributeNode:
+		if out.kind == elementNode {
+			t.tree.setAttr(out, n.name, n.value)
+		}
+	case textNode:
+		t.tree.appendText(out, n.value, n.raw)
+	case commentNode:
+		t.tree.appendChild(out, commentNode, "", n.value)
+	}
+}
+
+type comment struct {
+	body []instruction
+}
+
+func (i *comment) execute(t *transformer, c *context, out *node) {
+	fragment := t.tree.newNode(rootNode, "", "")
+	t.execute(c, i.body, fragment)
+	t.tree.appendChild(out, commentNode, "", fragment.stringValue())
+}
+
+type message struct {
+	body      []instruction
+	terminate bool
+}
+
+func (i *message) execute(t *transformer, c *context, out *node) {
+	if !i.terminate {
+		return
+	}
+	fragment := t.tree.newNode(rootNode, "", "")
+	t.execute(c, i.body, fragment)
+	fail("stylesheet terminated: %s", fragment.stringValue())
+}
+
+type sortKey struct {
+	selectExpr expr
+	descending bool
+	numeric    bool
+}
+
+func compileSort(element *etree.Element) (*sortKey, error) {
+	source := element.SelectAttrValue("select", ".")
+	selectExpr, err := compileXPath(source)
+	if err != nil {
+		return nil, err
+	}
+	return &sortKey{
+		selectExpr: selectExpr,
+		descending: element.SelectAttrValue("order", "ascending") == "descending",
+		numeric:    element.SelectAttrValue("data-type", "text") == "number",
+	}, nil
+}
+
+func sortByKeys(c *context, nodes []*node, keys []*sortKey) []*node {
+	if len(keys) == 0 {
+		return nodes
+	}
+
+	values := make(map[*node][]any, len(nodes))
+	for index, n := range nodes {
+		inner := *c
+		inner.node = n
+		inner.current = n
+		inner.position = index + 1
+		inner.size = len(nodes)
+		for _, key := range keys {
+			value := key.selectExpr.eval(&inner)
+			if key.numeric {
+				values[n] = append(values[n], toNumber(value))
+			} else {
+				values[n] = append(values[n], toString(value))
+			}
+		}
+	}
+
+	sorted := slices.Clone(nodes)
+	slices.SortStableFunc(sorted, func(a, b *node) int {
+		for k, key := range keys {
+			var result int
+			if key.numeric {
+				x, y := values[a][k].(float64), values[b][k].(float64)
+				switch {
+				case math.IsNaN(x) && math.IsNaN(y):
+					result = 0
+				case math.IsNaN(x):
+					result = -1
+				case math.IsNaN(y):
+					result = 1
+				default:
+					result = cmp.Compare(x, y)
+				}
+			} else {
+				result = strings.Compare(values[a][k].(string), values[b][k].(string))
+			}
+			if key.descending {
+				result = -result
+			}
+			if result != 0 {
+				return result
+			}
+		}
+		return 0
+	})
+	return sorted
+}
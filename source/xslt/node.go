@@ -0,0 +1,164 @@
+package xslt
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+type nodeKind int
+
+const (
+	rootNode nodeKind = iota
+	elementNode
+	attributeNode
+	textNode
+	commentNode
+)
+
+// node is the tree model shared by source documents, result trees and
+// result tree fragments. XPath needs parent links, attribute nodes and a
+// document order, none of which etree offers directly.
+type node struct {
+	kind     nodeKind
+	name     string
+	value    string
+	raw      bool
+	parent   *node
+	children []*node
+	attrs    []*node
+	order    int
+}
+
+// tree hands out document order numbers. Nodes are always created in
+// document order, so a single counter per transformation is enough to
+// order nodes across the source document and every result tree fragment.
+type tree struct {
+	counter int
+}
+
+func (t *tree) newNode(kind nodeKind, name string, value string) *node {
+	t.counter++
+	return &node{kind: kind, name: name, value: value, order: t.counter}
+}
+
+func (t *tree) appendChild(parent *node, kind nodeKind, name string, value string) *node {
+	child := t.newNode(kind, name, value)
+	child.parent = parent
+	parent.children = append(parent.children, child)
+	return child
+}
+
+func (t *tree) appendText(parent *node, text string, raw bool) {
+	if text == "" {
+		return
+	}
+	if last := len(parent.children) - 1; last >= 0 {
+		if prev := parent.children[last]; prev.kind == textNode && prev.raw == raw {
+			prev.value += text
+			return
+		}
+	}
+	t.appendChild(parent, textNode, "", text).raw = raw
+}
+
+func (t *tree) setAttr(element *node, name string, value string) {
+	for _, attr := range element.attrs {
+		if attr.name == name {
+			attr.value = value
+			return
+		}
+	}
+	attr := t.newNode(attributeNode, name, value)
+	attr.parent = element
+	element.attrs = append(element.attrs, attr)
+}
+
+// fromDocument converts an etree document, dropping whitespace-only text
+// in elements selected by strip.
+func (t *tree) fromDocument(doc *etree.Document, strip func(name string) bool) *node {
+	root := t.newNode(rootNode, "", "")
+	t.copyEtree(root, &doc.Element, strip)
+	return root
+}
+
+func (t *tree) copyEtree(dst *node, src *etree.Element, strip func(name string) bool) {
+	for _, token := range src.Child {
+		switch child := token.(type) {
+		case *etree.Element:
+			element := t.appendChild(dst, elementNode, child.FullTag(), "")
+			for _, attr := range child.Attr {
+				if attr.Space == "xmlns" || (attr.Space == "" && attr.Key == "xmlns") {
+					continue
+				}
+				t.setAttr(element, attr.FullKey(), attr.Value)
+			}
+			t.copyEtree(element, child, strip)
+		case *etree.CharData:
+			if dst.kind == elementNode && strip(dst.name) && strings.TrimSpace(child.Data) == "" {
+				continue
+			}
+			t.appendText(dst, child.Data, false)
+		case *etree.Comment:
+			t.appendChild(dst, commentNode, "", child.Data)
+		}
+	}
+}
+
+func (n *node) stringValue() string {
+	switch n.kind {
+	case rootNode, elementNode:
+		var builder strings.Builder
+		n.collectText(&builder)
+		return builder.String()
+	default:
+		return n.value
+	}
+}
+
+func (n *node) collectText(builder *strings.Builder) {
+	for _, child := range n.children {
+		switch child.kind {
+		case textNode:
+			builder.WriteString(child.value)
+		case elementNode:
+			child.collectText(builder)
+		}
+	}
+}
+
+func (n *node) root() *node {
+	for n.parent != nil {
+		n = n.parent
+	}
+	return n
+}
+
+func (n *node) localName() string {
+	if _, local, found := strings.Cut(n.name, ":"); found {
+		return local
+	}
+	return n.name
+}
+
+func (n *node) descendants(nodes []*node) []*node {
+	for _, child := range n.children {
+		nodes = append(nodes, child)
+		nodes = child.descendants(nodes)
+	}
+	return nodes
+}
+
+func (n *node) siblingIndex() int {
+	if n.parent == nil || n.kind == attributeNode {
+		return -1
+	}
+	return slices.Index(n.parent.children, n)
+}
+
+// sortNodes puts a node-set in document order and drops duplicates.
+func sortNodes(nodes []*node) []*node {
+	slices.SortFunc(nodes, func(a, b *node) int { return a.order - b.order })
+	return slices.CompactFunc(nodes, func(a, b *node) bool { return a == b })
+}
@@ -0,0 +1,118 @@
+package xslt
+
+import (
+	"strings"
+)
+
+// voidElements are written without an end tag by the html output method.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+func (s *Stylesheet) serialize(root *node) []byte {
+	method := s.output.method
+	if method == "" {
+		method = "xml"
+		for _, child := range root.children {
+			if child.kind == elementNode {
+				if strings.EqualFold(child.name, "html") {
+					method = "html"
+				}
+				break
+			}
+		}
+	}
+
+	var builder strings.Builder
+	switch method {
+	case "text":
+		builder.WriteString(root.stringValue())
+	default:
+		html := method == "html"
+		if !html && !s.output.omitXMLDecl {
+			builder.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+		}
+		w := &writer{builder: &builder, html: html, indent: s.output.indent}
+		for _, child := range root.children {
+			w.write(child, 0)
+			if child.kind != textNode {
+				builder.WriteString("\n")
+			}
+		}
+	}
+	return []byte(builder.String())
+}
+
+type writer struct {
+	builder *strings.Builder
+	html    bool
+	indent  bool
+}
+
+func (w *writer) write(n *node, depth int) {
+	switch n.kind {
+	case textNode:
+		if n.raw {
+			w.builder.WriteString(n.value)
+		} else {
+			w.builder.WriteString(escapeText(n.value))
+		}
+	case commentNode:
+		w.builder.WriteString("<!--" + n.value + "-->")
+	case elementNode:
+		w.builder.WriteString("<" + n.name)
+		for _, attr := range n.attrs {
+			w.builder.WriteString(" " + attr.name + "=\"" + escapeAttr(attr.value) + "\"")
+		}
+
+		if len(n.children) == 0 {
+			switch {
+			case w.html && voidElements[strings.ToLower(n.name)]:
+				w.builder.WriteString(">")
+			case w.html:
+				w.builder.WriteString("></" + n.name + ">")
+			default:
+				w.builder.WriteString("/>")
+			}
+			return
+		}
+		w.builder.WriteString(">")
+
+		indent := w.indent && !hasText(n)
+		for _, child := range n.children {
+			if indent {
+				w.builder.WriteString("\n" + strings.Repeat("  ", depth+1))
+			}
+			w.write(child, depth+1)
+		}
+		if indent {
+			w.builder.WriteString("\n" + strings.Repeat("  ", depth))
+		}
+		w.builder.WriteString("</" + n.name + ">")
+	}
+}
+
+// hasText reports whether n has mixed content, which must not be indented
+// since the added whitespace would become part of the text.
+func hasText(n *node) bool {
+	for _, child := range n.children {
+		if child.kind == textNode {
+			return true
+		}
+	}
+	return false
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;", "\n", "&#10;", "\t", "&#9;")
+
+func escapeText(text string) string {
+	return textEscaper.Replace(text)
+}
+
+func escapeAttr(text string) string {
+	return attrEscaper.Replace(text)
+}
@@ -0,0 +1,779 @@
+package xslt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokName
+	tokNodeType
+	tokFunction
+	tokAxis
+	tokVariable
+	tokLiteral
+	tokNumber
+	tokOperator
+	tokPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+var nodeTypes = map[string]bool{
+	"node":                   true,
+	"text":                   true,
+	"comment":                true,
+	"processing-instruction": true,
+}
+
+var operatorNames = map[string]bool{
+	"and": true,
+	"or":  true,
+	"div": true,
+	"mod": true,
+}
+
+// tokenize splits an XPath expression, resolving the lexical ambiguities of
+// XPath 1.0: '*' and the names and/or/div/mod are operators only when a
+// preceding token could end an operand.
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	operandEnded := func() bool {
+		if len(tokens) == 0 {
+			return false
+		}
+		prev := tokens[len(tokens)-1]
+		switch prev.kind {
+		case tokOperator, tokAxis:
+			return false
+		case tokPunct:
+			return prev.value == ")" || prev.value == "]" || prev.value == "." || prev.value == ".."
+		}
+		return true
+	}
+
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '(' || c == ')' || c == '[' || c == ']' || c == ',' || c == '@':
+			tokens = append(tokens, token{tokPunct, string(c)})
+			i++
+
+		case c == '.' && i+1 < len(source) && source[i+1] == '.':
+			tokens = append(tokens, token{tokPunct, ".."})
+			i += 2
+
+		case c == '.' && (i+1 >= len(source) || !isDigit(source[i+1])):
+			tokens = append(tokens, token{tokPunct, "."})
+			i++
+
+		case c == '.' || isDigit(c):
+			start := i
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, source[start:i]})
+
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(source[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string literal in %q", source)
+			}
+			tokens = append(tokens, token{tokLiteral, source[i+1 : i+1+end]})
+			i += end + 2
+
+		case c == '$':
+			name, next := readQName(source, i+1)
+			if name == "" {
+				return nil, fmt.Errorf("missing variable name in %q", source)
+			}
+			tokens = append(tokens, token{tokVariable, name})
+			i = next
+
+		case c == '/':
+			if i+1 < len(source) && source[i+1] == '/' {
+				tokens = append(tokens, token{tokOperator, "//"})
+				i += 2
+			} else {
+				tokens = append(tokens, token{tokOperator, "/"})
+				i++
+			}
+
+		case c == '|' || c == '+' || c == '-' || c == '=':
+			tokens = append(tokens, token{tokOperator, string(c)})
+			i++
+
+		case c == '!' || c == '<' || c == '>':
+			if i+1 < len(source) && source[i+1] == '=' {
+				tokens = append(tokens, token{tokOperator, source[i : i+2]})
+				i += 2
+			} else if c == '!' {
+				return nil, fmt.Errorf("unexpected '!' in %q", source)
+			} else {
+				tokens = append(tokens, token{tokOperator, string(c)})
+				i++
+			}
+
+		case c == '*':
+			if operandEnded() {
+				tokens = append(tokens, token{tokOperator, "*"})
+			} else {
+				tokens = append(tokens, token{tokName, "*"})
+			}
+			i++
+
+		default:
+			name, next := readQName(source, i)
+			if name == "" {
+				return nil, fmt.Errorf("unexpected character %q in %q", c, source)
+			}
+			i = next
+
+			if operandEnded() && operatorNames[name] {
+				tokens = append(tokens, token{tokOperator, name})
+				continue
+			}
+
+			lookahead := i
+			for lookahead < len(source) && strings.IndexByte(" \t\n\r", source[lookahead]) >= 0 {
+				lookahead++
+			}
+			switch {
+			case strings.HasPrefix(source[lookahead:], "::"):
+				tokens = append(tokens, token{tokAxis, name})
+				i = lookahead + 2
+			case lookahead < len(source) && source[lookahead] == '(' && nodeTypes[name]:
+				tokens = append(tokens, token{tokNodeType, name})
+			case lookahead < len(source) && source[lookahead] == '(':
+				tokens = append(tokens, token{tokFunction, name})
+			default:
+				tokens = append(tokens, token{tokName, name})
+			}
+		}
+	}
+
+	return append(tokens, token{tokEOF, ""}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameRune(r rune, first bool) bool {
+	if r == '_' || unicode.IsLetter(r) {
+		return true
+	}
+	return !first && (r == '-' || r == '.' || unicode.IsDigit(r))
+}
+
+func readNCName(source string, i int) (string, int) {
+	start := i
+	for i < len(source) {
+		r, size := utf8.DecodeRuneInString(source[i:])
+		if !isNameRune(r, i == start) {
+			break
+		}
+		i += size
+	}
+	return source[start:i], i
+}
+
+// readQName reads a name, a prefixed name, or a prefix:* name test.
+func readQName(source string, i int) (string, int) {
+	prefix, next := readNCName(source, i)
+	if prefix == "" || next+1 >= len(source) || source[next] != ':' || source[next+1] == ':' {
+		return prefix, next
+	}
+	if source[next+1] == '*' {
+		return prefix + ":*", next + 2
+	}
+	local, end := readNCName(source, next+1)
+	if local == "" {
+		return prefix, next
+	}
+	return prefix + ":" + local, end
+}
+
+// expr is a compiled XPath expression. Evaluation reports errors by
+// panicking with an *evalError, recovered at the transformation boundary.
+type expr interface {
+	eval(c *context) any
+}
+
+type evalError struct {
+	err error
+}
+
+func fail(format string, args ...any) {
+	panic(&evalError{fmt.Errorf(format, args...)})
+}
+
+type context struct {
+	node     *node
+	position int
+	size     int
+	current  *node
+	vars     *scope
+	tree     *tree
+}
+
+type scope struct {
+	name   string
+	value  any
+	parent *scope
+}
+
+func (s *scope) with(name string, value any) *scope {
+	return &scope{name: name, value: value, parent: s}
+}
+
+func (s *scope) lookup(name string) (any, bool) {
+	for ; s != nil; s = s.parent {
+		if s.name == name {
+			return s.value, true
+		}
+	}
+	return nil, false
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	source string
+}
+
+func compileXPath(source string) (expr, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, source: source}
+	result, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	return result, nil
+}
+
+func (p *parser) parse() (result expr, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			parseErr, ok := r.(*evalError)
+			if !ok {
+				panic(r)
+			}
+			err = parseErr.err
+		}
+	}()
+
+	result = p.parseOr()
+	if p.peek().kind != tokEOF {
+		fail("unexpected %q", p.peek().value)
+	}
+	return result, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isOperator(values ...string) bool {
+	t := p.peek()
+	if t.kind != tokOperator {
+		return false
+	}
+	for _, value := range values {
+		if t.value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) isPunct(value string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.value == value
+}
+
+func (p *parser) expectPunct(value string) {
+	if !p.isPunct(value) {
+		fail("expected %q, found %q", value, p.peek().value)
+	}
+	p.next()
+}
+
+func (p *parser) parseBinary(operand func() expr, operators ...string) expr {
+	left := operand()
+	for p.isOperator(operators...) {
+		op := p.next().value
+		left = &binaryExpr{op: op, left: left, right: operand()}
+	}
+	return left
+}
+
+func (p *parser) parseOr() expr {
+	return p.parseBinary(p.parseAnd, "or")
+}
+
+func (p *parser) parseAnd() expr {
+	return p.parseBinary(p.parseEquality, "and")
+}
+
+func (p *parser) parseEquality() expr {
+	return p.parseBinary(p.parseRelational, "=", "!=")
+}
+
+func (p *parser) parseRelational() expr {
+	return p.parseBinary(p.parseAdditive, "<", "<=", ">", ">=")
+}
+
+func (p *parser) parseAdditive() expr {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *parser) parseMultiplicative() expr {
+	return p.parseBinary(p.parseUnary, "*", "div", "mod")
+}
+
+func (p *parser) parseUnary() expr {
+	if p.isOperator("-") {
+		p.next()
+		return &negateExpr{operand: p.parseUnary()}
+	}
+	return p.parseUnion()
+}
+
+func (p *parser) parseUnion() expr {
+	left := p.parsePath()
+	for p.isOperator("|") {
+		p.next()
+		left = &unionExpr{left: left, right: p.parsePath()}
+	}
+	return left
+}
+
+func (p *parser) startsStep() bool {
+	t := p.peek()
+	switch t.kind {
+	case tokName, tokNodeType, tokAxis:
+		return true
+	case tokPunct:
+		return t.value == "." || t.value == ".." || t.value == "@"
+	}
+	return false
+}
+
+func (p *parser) parsePath() expr {
+	t := p.peek()
+	switch {
+	case p.isOperator("/"):
+		p.next()
+		path := &pathExpr{absolute: true}
+		if p.startsStep() {
+			path.steps = p.parseRelativeSteps()
+		}
+		return path
+
+	case p.isOperator("//"):
+		p.next()
+		steps := append([]*step{descendantOrSelfStep()}, p.parseRelativeSteps()...)
+		return &pathExpr{absolute: true, steps: steps}
+
+	case t.kind == tokVariable || t.kind == tokLiteral || t.kind == tokNumber ||
+		t.kind == tokFunction || (t.kind == tokPunct && t.value == "("):
+		var filter expr = p.parsePrimary()
+		if p.isPunct("[") {
+			filter = &filterExpr{primary: filter, predicates: p.parsePredicates()}
+		}
+		if p.isOperator("/", "//") {
+			return &pathExpr{base: filter, steps: p.parseFollowingSteps()}
+		}
+		return filter
+
+	default:
+		return &pathExpr{steps: p.parseRelativeSteps()}
+	}
+}
+
+func (p *parser) parseFollowingSteps() []*step {
+	var steps []*step
+	for p.isOperator("/", "//") {
+		if p.next().value == "//" {
+			steps = append(steps, descendantOrSelfStep())
+		}
+		steps = append(steps, p.parseStep())
+	}
+	return steps
+}
+
+func (p *parser) parseRelativeSteps() []*step {
+	steps := []*step{p.parseStep()}
+	return append(steps, p.parseFollowingSteps()...)
+}
+
+func descendantOrSelfStep() *step {
+	return &step{axis: "descendant-or-self", test: nodeTest{kind: "node"}}
+}
+
+func (p *parser) parseStep() *step {
+	if p.isPunct(".") {
+		p.next()
+		return &step{axis: "self", test: nodeTest{kind: "node"}}
+	}
+	if p.isPunct("..") {
+		p.next()
+		return &step{axis: "parent", test: nodeTest{kind: "node"}}
+	}
+
+	s := &step{axis: "child"}
+	if p.isPunct("@") {
+		p.next()
+		s.axis = "attribute"
+	} else if p.peek().kind == tokAxis {
+		s.axis = p.next().value
+		if _, ok := axes[s.axis]; !ok {
+			fail("unknown axis %q", s.axis)
+		}
+	}
+
+	t := p.next()
+	switch t.kind {
+	case tokName:
+		s.test = nodeTest{name: t.value}
+	case tokNodeType:
+		s.test = nodeTest{kind: t.value}
+		p.expectPunct("(")
+		if t.value == "processing-instruction" && p.peek().kind == tokLiteral {
+			p.next()
+		}
+		p.expectPunct(")")
+	default:
+		fail("expected a node test, found %q", t.value)
+	}
+
+	s.predicates = p.parsePredicates()
+	return s
+}
+
+func (p *parser) parsePredicates() []expr {
+	var predicates []expr
+	for p.isPunct("[") {
+		p.next()
+		predicates = append(predicates, p.parseOr())
+		p.expectPunct("]")
+	}
+	return predicates
+}
+
+func (p *parser) parsePrimary() expr {
+	t := p.next()
+	switch t.kind {
+	case tokVariable:
+		return &variableExpr{name: t.value}
+	case tokLiteral:
+		return &literalExpr{value: t.value}
+	case tokNumber:
+		number, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			fail("invalid number %q", t.value)
+		}
+		return &literalExpr{value: number}
+	case tokFunction:
+		call := &functionExpr{name: t.value}
+		if _, _, found := strings.Cut(t.value, ":"); found {
+			call.name = t.value[strings.IndexByte(t.value, ':')+1:]
+		}
+		if _, ok := functions[call.name]; !ok {
+			fail("unsupported function %q", t.value)
+		}
+		p.expectPunct("(")
+		for !p.isPunct(")") {
+			call.args = append(call.args, p.parseOr())
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+		p.expectPunct(")")
+		return call
+	case tokPunct:
+		if t.value == "(" {
+			inner := p.parseOr()
+			p.expectPunct(")")
+			return inner
+		}
+	}
+	fail("unexpected %q", t.value)
+	return nil
+}
+
+type literalExpr struct {
+	value any
+}
+
+func (e *literalExpr) eval(c *context) any {
+	return e.value
+}
+
+type variableExpr struct {
+	name string
+}
+
+func (e *variableExpr) eval(c *context) any {
+	value, ok := c.vars.lookup(e.name)
+	if !ok {
+		fail("undefined variable $%s", e.name)
+	}
+	return value
+}
+
+type negateExpr struct {
+	operand expr
+}
+
+func (e *negateExpr) eval(c *context) any {
+	return -toNumber(e.operand.eval(c))
+}
+
+type unionExpr struct {
+	left, right expr
+}
+
+func (e *unionExpr) eval(c *context) any {
+	left := toNodeSet(e.left.eval(c))
+	right := toNodeSet(e.right.eval(c))
+	return sortNodes(append(append([]*node{}, left...), right...))
+}
+
+type filterExpr struct {
+	primary    expr
+	predicates []expr
+}
+
+func (e *filterExpr) eval(c *context) any {
+	nodes := toNodeSet(e.primary.eval(c))
+	for _, predicate := range e.predicates {
+		nodes = applyPredicate(c, nodes, predicate)
+	}
+	return nodes
+}
+
+type pathExpr struct {
+	absolute bool
+	base     expr
+	steps    []*step
+}
+
+func (e *pathExpr) eval(c *context) any {
+	var nodes []*node
+	switch {
+	case e.absolute:
+		nodes = []*node{c.node.root()}
+	case e.base != nil:
+		nodes = toNodeSet(e.base.eval(c))
+	default:
+		nodes = []*node{c.node}
+	}
+
+	for _, s := range e.steps {
+		nodes = s.apply(c, nodes)
+	}
+	return nodes
+}
+
+type nodeTest struct {
+	kind string
+	name string
+}
+
+func (t nodeTest) matches(n *node, axis string) bool {
+	switch t.kind {
+	case "node":
+		return true
+	case "text":
+		return n.kind == textNode
+	case "comment":
+		return n.kind == commentNode
+	case "processing-instruction":
+		return false
+	}
+
+	principal := elementNode
+	if axis == "attribute" {
+		principal = attributeNode
+	}
+	if n.kind != principal {
+		return false
+	}
+	if t.name == "*" {
+		return true
+	}
+	if prefix, found := strings.CutSuffix(t.name, ":*"); found {
+		return strings.HasPrefix(n.name, prefix+":")
+	}
+	return n.name == t.name
+}
+
+type step struct {
+	axis       string
+	test       nodeTest
+	predicates []expr
+}
+
+// apply evaluates the step for every input node. Candidates are produced
+// in axis order so that positional predicates on reverse axes count from
+// the context node outwards, then the union is returned in document order.
+func (s *step) apply(c *context, input []*node) []*node {
+	var result []*node
+	for _, n := range input {
+		var candidates []*node
+		for _, candidate := range axes[s.axis](n) {
+			if s.test.matches(candidate, s.axis) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		for _, predicate := range s.predicates {
+			candidates = applyPredicate(c, candidates, predicate)
+		}
+		result = append(result, candidates...)
+	}
+	return sortNodes(result)
+}
+
+func applyPredicate(c *context, nodes []*node, predicate expr) []*node {
+	var kept []*node
+	for i, n := range nodes {
+		inner := *c
+		inner.node = n
+		inner.position = i + 1
+		inner.size = len(nodes)
+
+		value := predicate.eval(&inner)
+		if number, ok := value.(float64); ok {
+			if number == float64(i+1) {
+				kept = append(kept, n)
+			}
+		} else if toBoolean(value) {
+			kept = append(kept, n)
+		}
+	}
+	return kept
+}
+
+var axes map[string]func(n *node) []*node
+
+func init() {
+	axes = map[string]func(n *node) []*node{
+		"child": func(n *node) []*node {
+			return n.children
+		},
+		"descendant": func(n *node) []*node {
+			return n.descendants(nil)
+		},
+		"descendant-or-self": func(n *node) []*node {
+			return n.descendants([]*node{n})
+		},
+		"self": func(n *node) []*node {
+			return []*node{n}
+		},
+		"parent": func(n *node) []*node {
+			if n.parent == nil {
+				return nil
+			}
+			return []*node{n.parent}
+		},
+		"ancestor": func(n *node) []*node {
+			var nodes []*node
+			for a := n.parent; a != nil; a = a.parent {
+				nodes = append(nodes, a)
+			}
+			return nodes
+		},
+		"ancestor-or-self": func(n *node) []*node {
+			var nodes []*node
+			for a := n; a != nil; a = a.parent {
+				nodes = append(nodes, a)
+			}
+			return nodes
+		},
+		"attribute": func(n *node) []*node {
+			return n.attrs
+		},
+		"following-sibling": func(n *node) []*node {
+			index := n.siblingIndex()
+			if index < 0 {
+				return nil
+			}
+			return n.parent.children[index+1:]
+		},
+		"preceding-sibling": func(n *node) []*node {
+			index := n.siblingIndex()
+			if index < 0 {
+				return nil
+			}
+			var nodes []*node
+			for i := index - 1; i >= 0; i-- {
+				nodes = append(nodes, n.parent.children[i])
+			}
+			return nodes
+		},
+		"following": func(n *node) []*node {
+			var nodes []*node
+			for a := n; a != nil; a = a.parent {
+				index := a.siblingIndex()
+				if index < 0 {
+					continue
+				}
+				for _, sibling := range a.parent.children[index+1:] {
+					nodes = append(nodes, sibling)
+					nodes = sibling.descendants(nodes)
+				}
+			}
+			return sortNodes(nodes)
+		},
+		"preceding": func(n *node) []*node {
+			var nodes []*node
+			for a := n; a != nil; a = a.parent {
+				index := a.siblingIndex()
+				if index < 0 {
+					continue
+				}
+				for i := index - 1; i >= 0; i-- {
+					sibling := a.parent.children[i]
+					descendants := sibling.descendants(nil)
+					for j := len(descendants) - 1; j >= 0; j-- {
+						nodes = append(nodes, descendants[j])
+					}
+					nodes = append(nodes, sibling)
+				}
+			}
+			return nodes
+		},
+		"namespace": func(n *node) []*node {
+			return nil
+		},
+	}
+}
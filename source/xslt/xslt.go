@@ -0,0 +1,434 @@
+// Package xslt is a small in-process XSLT 1.0 processor covering the parts
+// of the language that site stylesheets rely on: template rules and modes,
+// named templates with parameters, variables, conditionals, iteration and
+// sorting, literal result elements with attribute value templates, and the
+// EXSLT node-set function. It needs no external binary.
+//
+// Namespaces are matched by prefix rather than by URI, and xsl:import,
+// xsl:include, xsl:key and xsl:number are not supported.
+package xslt
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+const xslNamespace = "http://www.w3.org/1999/XSL/Transform"
+
+// maxDepth bounds template recursion so that a runaway stylesheet fails
+// with an error instead of exhausting the stack.
+const maxDepth = 3000
+
+type Stylesheet struct {
+	rules    []*rule
+	named    map[string]*template
+	globals  []*variable
+	output   output
+	strip    []string
+	preserve []string
+}
+
+type output struct {
+	method      string
+	indent      bool
+	omitXMLDecl bool
+}
+
+type template struct {
+	name   string
+	mode   string
+	params []*variable
+	body   []instruction
+}
+
+type rule struct {
+	template *template
+	pattern  expr
+	priority float64
+	order    int
+}
+
+type variable struct {
+	name       string
+	param      bool
+	selectExpr expr
+	body       []instruction
+}
+
+// execute does nothing: a variable extends the scope of the instructions
+// that follow it, so transformer.execute binds it instead.
+func (v *variable) execute(t *transformer, c *context, out *node) {}
+
+// Load compiles the stylesheet at path.
+func Load(path string) (*Stylesheet, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(path); err != nil {
+		return nil, fmt.Errorf("failed reading stylesheet: %w", err)
+	}
+
+	root := doc.Root()
+	if root == nil || root.NamespaceURI() != xslNamespace || (root.Tag != "stylesheet" && root.Tag != "transform") {
+		return nil, fmt.Errorf("%s is not an XSLT stylesheet", path)
+	}
+
+	sheet := &Stylesheet{named: map[string]*template{}}
+	for _, child := range root.ChildElements() {
+		if child.NamespaceURI() != xslNamespace {
+			continue
+		}
+		if err := sheet.compileTopLevel(child); err != nil {
+			return nil, fmt.Errorf("%s: %w", child.GetPath(), err)
+		}
+	}
+	return sheet, nil
+}
+
+func (s *Stylesheet) compileTopLevel(element *etree.Element) error {
+	switch element.Tag {
+	case "output":
+		s.output.method = element.SelectAttrValue("method", "")
+		s.output.indent = element.SelectAttrValue("indent", "no") == "yes"
+		s.output.omitXMLDecl = element.SelectAttrValue("omit-xml-declaration", "no") == "yes"
+
+	case "strip-space":
+		s.strip = append(s.strip, strings.Fields(element.SelectAttrValue("elements", ""))...)
+
+	case "preserve-space":
+		s.preserve = append(s.preserve, strings.Fields(element.SelectAttrValue("elements", ""))...)
+
+	case "variable", "param":
+		v, err := compileVariable(element)
+		if err != nil {
+			return err
+		}
+		s.globals = append(s.globals, v)
+
+	case "template":
+		return s.compileTemplate(element)
+
+	default:
+		return fmt.Errorf("unsupported top-level element xsl:%s", element.Tag)
+	}
+	return nil
+}
+
+func (s *Stylesheet) compileTemplate(element *etree.Element) error {
+	t := &template{
+		name: element.SelectAttrValue("name", ""),
+		mode: element.SelectAttrValue("mode", ""),
+	}
+
+	var bodyElement etree.Element
+	for _, token := range element.Child {
+		if child, ok := token.(*etree.Element); ok && child.NamespaceURI() == xslNamespace && child.Tag == "param" {
+			param, err := compileVariable(child)
+			if err != nil {
+				return err
+			}
+			t.params = append(t.params, param)
+			continue
+		}
+		bodyElement.Child = append(bodyElement.Child, token)
+	}
+
+	body, err := compileBody(&bodyElement)
+	if err != nil {
+		return err
+	}
+	t.body = body
+
+	if t.name != "" {
+		s.named[t.name] = t
+	}
+
+	match := element.SelectAttrValue("match", "")
+	if match == "" {
+		if t.name == "" {
+			return fmt.Errorf("template without match or name")
+		}
+		return nil
+	}
+
+	pattern, err := compileXPath(match)
+	if err != nil {
+		return err
+	}
+
+	var explicitPriority *float64
+	if priority := element.SelectAttr("priority"); priority != nil {
+		value := stringToNumber(priority.Value)
+		explicitPriority = &value
+	}
+
+	for _, alternative := range splitUnion(pattern) {
+		r := &rule{template: t, pattern: alternative, order: len(s.rules)}
+		if explicitPriority != nil {
+			r.priority = *explicitPriority
+		} else {
+			r.priority = defaultPriority(alternative)
+		}
+		s.rules = append(s.rules, r)
+	}
+	return nil
+}
+
+func splitUnion(pattern expr) []expr {
+	if union, ok := pattern.(*unionExpr); ok {
+		return append(splitUnion(union.left), splitUnion(union.right)...)
+	}
+	return []expr{pattern}
+}
+
+// defaultPriority follows section 5.5 of the XSLT 1.0 recommendation.
+func defaultPriority(pattern expr) float64 {
+	path, ok := pattern.(*pathExpr)
+	if !ok || path.absolute || path.base != nil || len(path.steps) != 1 {
+		return 0.5
+	}
+
+	s := path.steps[0]
+	if len(s.predicates) > 0 {
+		return 0.5
+	}
+	switch {
+	case s.test.kind != "" || s.test.name == "*":
+		return -0.5
+	case strings.HasSuffix(s.test.name, ":*"):
+		return -0.25
+	}
+	return 0
+}
+
+func compileVariable(element *etree.Element) (*variable, error) {
+	v := &variable{
+		name:  element.SelectAttrValue("name", ""),
+		param: element.Tag == "param",
+	}
+	if v.name == "" {
+		return nil, fmt.Errorf("xsl:%s without a name", element.Tag)
+	}
+
+	if selectAttr := element.SelectAttr("select"); selectAttr != nil {
+		selectExpr, err := compileXPath(selectAttr.Value)
+		if err != nil {
+			return nil, err
+		}
+		v.selectExpr = selectExpr
+		return v, nil
+	}
+
+	body, err := compileBody(element)
+	if err != nil {
+		return nil, err
+	}
+	v.body = body
+	return v, nil
+}
+
+// Transform applies the stylesheet to doc. Params override global
+// parameters of the same name; parameters the stylesheet does not declare
+// are ignored.
+func (s *Stylesheet) Transform(doc *etree.Document, params map[string]string) (result []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			evalErr, ok := r.(*evalError)
+			if !ok {
+				panic(r)
+			}
+			err = evalErr.err
+		}
+	}()
+
+	t := &transformer{sheet: s, tree: &tree{}}
+	source := t.tree.fromDocument(doc, s.stripSpace)
+	resultRoot := t.tree.newNode(rootNode, "", "")
+
+	c := &context{node: source, position: 1, size: 1, current: source, tree: t.tree}
+	for _, global := range s.globals {
+		if value, ok := params[global.name]; ok && global.param {
+			c.vars = c.vars.with(global.name, value)
+			continue
+		}
+		c.vars = c.vars.with(global.name, t.evalVariable(c, global))
+	}
+	t.globals = c.vars
+
+	t.applyTemplates(c, []*node{source}, "", nil, resultRoot)
+	return s.serialize(resultRoot), nil
+}
+
+func (s *Stylesheet) stripSpace(name string) bool {
+	matches := func(patterns []string) bool {
+		return slices.ContainsFunc(patterns, func(pattern string) bool {
+			if prefix, found := strings.CutSuffix(pattern, ":*"); found {
+				return strings.HasPrefix(name, prefix+":")
+			}
+			return pattern == "*" || pattern == name
+		})
+	}
+	return matches(s.strip) && !matches(s.preserve)
+}
+
+type transformer struct {
+	sheet   *Stylesheet
+	tree    *tree
+	globals *scope
+	depth   int
+}
+
+func (t *transformer) findRule(c *context, n *node, mode string) *template {
+	var best *rule
+	for _, r := range t.sheet.rules {
+		if r.template.mode != mode {
+			continue
+		}
+		if best != nil && (r.priority < best.priority) {
+			continue
+		}
+		if !t.matches(c, r.pattern, n) {
+			continue
+		}
+		if best == nil || r.priority > best.priority || r.order > best.order {
+			best = r
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.template
+}
+
+// matches reports whether n matches pattern, by evaluating the pattern
+// from each ancestor of n and looking for n in the selected nodes.
+func (t *transformer) matches(c *context, pattern expr, n *node) bool {
+	if path, ok := pattern.(*pathExpr); ok && len(path.steps) > 0 {
+		last := path.steps[len(path.steps)-1]
+		axis := last.axis
+		if axis != "attribute" {
+			axis = "child"
+		}
+		if !last.test.matches(n, axis) {
+			return false
+		}
+	}
+
+	inner := *c
+	inner.vars = t.globals
+	start := n
+	if path, ok := pattern.(*pathExpr); ok && !path.absolute && path.base == nil && childSteps(path) {
+		for range path.steps {
+			if start == nil {
+				return false
+			}
+			start = start.parent
+		}
+		if start == nil {
+			return false
+		}
+		inner.node = start
+		inner.current = n
+		nodes, _ := pattern.eval(&inner).([]*node)
+		return slices.Contains(nodes, n)
+	}
+
+	for context := start; context != nil; context = context.parent {
+		inner.node = context
+		inner.current = n
+		if nodes, ok := pattern.eval(&inner).([]*node); ok && slices.Contains(nodes, n) {
+			return true
+		}
+		if path, ok := pattern.(*pathExpr); ok && path.absolute {
+			break
+		}
+	}
+	return false
+}
+
+// childSteps reports whether every step of path moves exactly one level
+// down, in which case a pattern only needs evaluating from one ancestor.
+func childSteps(path *pathExpr) bool {
+	for _, s := range path.steps {
+		if s.axis != "child" && s.axis != "attribute" {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *transformer) applyTemplates(c *context, nodes []*node, mode string, params map[string]any, out *node) {
+	t.depth++
+	defer func() { t.depth-- }()
+	if t.depth > maxDepth {
+		fail("template recursion deeper than %d levels", maxDepth)
+	}
+
+	for i, n := range nodes {
+		inner := &context{node: n, position: i + 1, size: len(nodes), current: n, tree: t.tree}
+
+		matched := t.findRule(inner, n, mode)
+		if matched == nil {
+			t.builtinTemplate(inner, n, mode, out)
+			continue
+		}
+		t.invoke(inner, matched, params, out)
+	}
+}
+
+func (t *transformer) builtinTemplate(c *context, n *node, mode string, out *node) {
+	switch n.kind {
+	case rootNode, elementNode:
+		t.applyTemplates(c, n.children, mode, nil, out)
+	case textNode, attributeNode:
+		t.tree.appendText(out, n.value, false)
+	}
+}
+
+func (t *transformer) invoke(c *context, tmpl *template, params map[string]any, out *node) {
+	c.vars = t.globals
+	for _, param := range tmpl.params {
+		if value, ok := params[param.name]; ok {
+			c.vars = c.vars.with(param.name, value)
+			continue
+		}
+		c.vars = c.vars.with(param.name, t.evalVariable(c, param))
+	}
+	t.execute(c, tmpl.body, out)
+}
+
+func (t *transformer) evalVariable(c *context, v *variable) any {
+	if v.selectExpr != nil {
+		return v.selectExpr.eval(c)
+	}
+	if len(v.body) == 0 {
+		return ""
+	}
+
+	fragment := t.tree.newNode(rootNode, "", "")
+	t.execute(c, v.body, fragment)
+	return []*node{fragment}
+}
+
+func (t *transformer) execute(c *context, body []instruction, out *node) {
+	local := *c
+	for _, instr := range body {
+		if v, ok := instr.(*variable); ok {
+			local.vars = local.vars.with(v.name, t.evalVariable(&local, v))
+			continue
+		}
+		instr.execute(t, &local, out)
+	}
+}
+
+func (t *transformer) evalParams(c *context, withParams []*variable) map[string]any {
+	if len(withParams) == 0 {
+		return nil
+	}
+	params := map[string]any{}
+	for _, param := range withParams {
+		params[param.name] = t.evalVariable(c, param)
+	}
+	return params
+}